@@ -0,0 +1,28 @@
+//go:build linux && go1.20
+// +build linux,go1.20
+
+package xxljob
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// startInCgroup makes the command start in the cgroup, so that all its allocations are counted.
+// It returns false if the process has to be moved into the cgroup after it starts.
+// The returned function closes the cgroup after the process starts.
+func startInCgroup(cmd *exec.Cmd, dir string) (func(), bool, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(f.Fd())
+
+	return func() { _ = f.Close() }, true, nil
+}
@@ -0,0 +1,35 @@
+package xxljob
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// createCgroup creates a cgroup v2 under the parent cgroup with the memory limit.
+// The parent cgroup must be delegated to the current user with the memory controller enabled.
+// The returned function removes the cgroup after the process exits.
+func createCgroup(parent, name string, memory int64) (string, func(), error) {
+	dir := filepath.Join(parent, name)
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return "", nil, err
+	}
+
+	cleanup := func() {
+		_ = os.Remove(dir)
+	}
+
+	if memory > 0 {
+		if err := os.WriteFile(filepath.Join(dir, "memory.max"), []byte(strconv.FormatInt(memory, 10)), 0644); err != nil {
+			cleanup()
+			return "", nil, err
+		}
+	}
+
+	return dir, cleanup, nil
+}
+
+// joinCgroup moves the running process into the cgroup.
+func joinCgroup(dir string, pid int) error {
+	return os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644)
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package xxljob
+
+import "errors"
+
+// createCgroup is only supported on linux.
+func createCgroup(parent, name string, memory int64) (string, func(), error) {
+	return "", nil, errors.New("cgroup is only supported on linux")
+}
+
+// joinCgroup is only supported on linux.
+func joinCgroup(dir string, pid int) error {
+	return errors.New("cgroup is only supported on linux")
+}
@@ -0,0 +1,109 @@
+package xxljob
+
+import "time"
+
+const (
+	// ConcurrencyWait: if the concurrency limit is reached, the job waits until a slot is free. (default)
+	ConcurrencyWait = "WAIT"
+	// ConcurrencyReject: if the concurrency limit is reached, the job is rejected when it is triggered.
+	ConcurrencyReject = "REJECT"
+)
+
+// jobName returns the name of the job, which is the handler name, or the glue type if there is no handler.
+func jobName(params RunParam) string {
+	if params.ExecutorHandler == "" {
+		return params.GlueType
+	}
+
+	return params.ExecutorHandler
+}
+
+// maxConcurrency returns the concurrency limit of the handler of the job, 0 means no limit.
+func (e *Executor) maxConcurrency(params RunParam) int {
+	if params.GlueType != "" && params.GlueType != GlueBean {
+		return 0
+	}
+
+	options, _ := e.GetHandlerOptions(params.ExecutorHandler)
+
+	return options.MaxConcurrency
+}
+
+// hasSlot checks if a job of the handler can be run without exceeding the global or handler concurrency limit.
+// The caller must hold e.mu.
+func (e *Executor) hasSlot(name string, limit int) bool {
+	if e.MaxConcurrentJobs > 0 && e.running >= e.MaxConcurrentJobs {
+		return false
+	}
+
+	return limit <= 0 || e.runningByHandler[name] < limit
+}
+
+// isBusy checks if a new job has to wait for a slot because of the global concurrency limit.
+// The jobs waiting for their handler limit do not make the executor busy for the other handlers.
+// The caller must hold e.mu.
+func (e *Executor) isBusy() bool {
+	return e.MaxConcurrentJobs > 0 && e.running >= e.MaxConcurrentJobs
+}
+
+// startJob runs the job if there is a free slot, otherwise it waits for one.
+// The caller must hold e.mu.
+func (e *Executor) startJob(job *Job) {
+	if !e.hasSlot(job.Name, job.maxConcurrency) {
+		e.Logger.Info(logPrefix+"[%d:%d] job is waiting for a slot, %d running", job.ID, job.LogID, e.running)
+		e.waiting = append(e.waiting, job)
+		return
+	}
+
+	e.runJob(job)
+}
+
+// runJob takes a slot and runs the job.
+// The caller must hold e.mu.
+func (e *Executor) runJob(job *Job) {
+	e.running++
+	e.runningByHandler[job.Name]++
+	job.slotted = true
+	job.startedAt = time.Now()
+
+	e.Logger.Info(logPrefix+"[%d:%d] job starts", job.ID, job.LogID)
+	go job.Run()
+}
+
+// releaseSlot frees the slot of the finished job and runs the waiting jobs which fit in.
+// The caller must hold e.mu.
+func (e *Executor) releaseSlot(job *Job) {
+	if !job.slotted {
+		return
+	}
+
+	job.slotted = false
+	e.running--
+	if e.runningByHandler[job.Name]--; e.runningByHandler[job.Name] <= 0 {
+		delete(e.runningByHandler, job.Name)
+	}
+
+	// Run the waiting jobs in the order of arrival, skipping the ones whose handler is still full.
+	waiting := e.waiting[:0]
+	for _, w := range e.waiting {
+		if e.hasSlot(w.Name, w.maxConcurrency) {
+			e.runJob(w)
+			continue
+		}
+		waiting = append(waiting, w)
+	}
+	e.waiting = waiting
+}
+
+// removeWaiting removes the job from the waiting list, it returns false if the job is not waiting.
+// The caller must hold e.mu.
+func (e *Executor) removeWaiting(job *Job) bool {
+	for i, w := range e.waiting {
+		if w == job {
+			e.waiting = append(e.waiting[:i], e.waiting[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
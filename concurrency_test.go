@@ -0,0 +1,244 @@
+package xxljob_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	resty "github.com/go-resty/resty/v2"
+	"github.com/hyperjiang/xxljob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrencyLimits(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(t.TempDir()),
+		xxljob.WithCallbackInterval("10ms"),
+		xxljob.WithMaxConcurrentJobs(2),
+	)
+	defer e.Stop()
+
+	srv := httptest.NewServer(e.Handler())
+	defer srv.Close()
+	cli := resty.New().SetBaseURL(srv.URL).SetHeader("XXL-JOB-ACCESS-TOKEN", accessToken)
+	idleBeat := func(jobID int) xxljob.Response {
+		resp, err := cli.R().SetBody(xxljob.IdleBeatParam{JobID: jobID}).Post("/idleBeat")
+		should.NoError(err)
+		var res xxljob.Response
+		should.NoError(json.Unmarshal(resp.Body(), &res))
+		return res
+	}
+
+	var running, peak int32
+	release := make(chan struct{})
+	block := func(ctx context.Context, param xxljob.JobParam) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	e.AddJobHandler("block", block)
+	e.AddJobHandler("single", block, xxljob.WithMaxConcurrency(1))
+
+	trigger := func(jobID int, logID int64, handler string) error {
+		return e.TriggerJob(xxljob.RunParam{
+			JobID:           jobID,
+			ExecutorHandler: handler,
+			LogID:           logID,
+			LogDateTime:     time.Now().UnixNano() / int64(time.Millisecond),
+		})
+	}
+
+	should.Equal(200, idleBeat(1).Code)
+
+	// Only 2 jobs run at the same time, the others wait for a slot.
+	for i := 1; i <= 4; i++ {
+		should.NoError(trigger(i, int64(i), "block"))
+	}
+	should.Eventually(func() bool { return atomic.LoadInt32(&running) == 2 }, time.Second, time.Millisecond*10)
+
+	// The executor reports busy, so that xxl-job server can pick another one.
+	res := idleBeat(5)
+	should.Equal(500, res.Code)
+	should.Equal("executor is busy, too many running jobs", res.Msg)
+
+	// A waiting job is discarded when it is killed.
+	resp, err := cli.R().SetBody(xxljob.KillParam{JobID: 4}).Post("/kill")
+	should.NoError(err)
+	should.Equal(200, resp.StatusCode())
+	cb := <-callbacks
+	should.Equal(int64(4), cb.LogID)
+	should.Equal(500, cb.HandleCode)
+	should.Equal("job killed by xxl-job server, job not executed", cb.HandleMsg)
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		should.Equal(200, (<-callbacks).HandleCode)
+	}
+	should.Equal(int32(2), atomic.LoadInt32(&peak))
+	should.Equal(200, idleBeat(5).Code)
+
+	// The handler limit is applied across job ids.
+	release = make(chan struct{})
+	atomic.StoreInt32(&peak, 0)
+	should.NoError(trigger(1, 11, "single"))
+	should.NoError(trigger(2, 12, "single"))
+	should.Eventually(func() bool { return atomic.LoadInt32(&running) == 1 }, time.Second, time.Millisecond*10)
+	time.Sleep(time.Millisecond * 50)
+	should.Equal(int32(1), atomic.LoadInt32(&running))
+
+	close(release)
+	should.Equal(200, (<-callbacks).HandleCode)
+	should.Equal(200, (<-callbacks).HandleCode)
+	should.Equal(int32(1), atomic.LoadInt32(&peak))
+}
+
+func TestHandlerConcurrencyNotBusy(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(t.TempDir()),
+		xxljob.WithCallbackInterval("10ms"),
+	)
+	defer e.Stop()
+
+	srv := httptest.NewServer(e.Handler())
+	defer srv.Close()
+	cli := resty.New().SetBaseURL(srv.URL).SetHeader("XXL-JOB-ACCESS-TOKEN", accessToken)
+
+	release := make(chan struct{})
+	e.AddJobHandler("single", func(ctx context.Context, param xxljob.JobParam) error {
+		<-release
+		return nil
+	}, xxljob.WithMaxConcurrency(1))
+
+	for i := 1; i <= 2; i++ {
+		should.NoError(e.TriggerJob(xxljob.RunParam{
+			JobID:           i,
+			ExecutorHandler: "single",
+			LogID:           int64(i),
+			LogDateTime:     time.Now().UnixNano() / int64(time.Millisecond),
+		}))
+	}
+
+	// The job waiting for the handler limit does not make the executor busy for the other jobs.
+	resp, err := cli.R().SetBody(xxljob.IdleBeatParam{JobID: 99}).Post("/idleBeat")
+	should.NoError(err)
+	var res xxljob.Response
+	should.NoError(json.Unmarshal(resp.Body(), &res))
+	should.Equal(200, res.Code, res.Msg)
+
+	close(release)
+	should.Equal(200, (<-callbacks).HandleCode)
+	should.Equal(200, (<-callbacks).HandleCode)
+}
+
+func TestConcurrencyReject(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(t.TempDir()),
+		xxljob.WithCallbackInterval("10ms"),
+		xxljob.WithMaxConcurrentJobs(1),
+		xxljob.WithConcurrencyPolicy(xxljob.ConcurrencyReject),
+	)
+	defer e.Stop()
+
+	release := make(chan struct{})
+	e.AddJobHandler("block", func(ctx context.Context, param xxljob.JobParam) error {
+		<-release
+		return nil
+	})
+
+	trigger := func(jobID int, logID int64) error {
+		return e.TriggerJob(xxljob.RunParam{
+			JobID:           jobID,
+			ExecutorHandler: "block",
+			LogID:           logID,
+			LogDateTime:     time.Now().UnixNano() / int64(time.Millisecond),
+		})
+	}
+
+	should.NoError(trigger(1, 1))
+	should.EqualError(trigger(2, 2), "executor is busy, too many running jobs")
+
+	// The job queued behind the job of the same id is accepted.
+	should.NoError(trigger(1, 3))
+	should.Len(e.QueuedJobs(1), 1)
+
+	close(release)
+	should.Equal(int64(1), (<-callbacks).LogID)
+	should.Equal(int64(3), (<-callbacks).LogID)
+	should.Empty(callbacks)
+
+	should.NoError(trigger(2, 4))
+	should.Equal(int64(4), (<-callbacks).LogID)
+}
+
+func TestHandlerConcurrencyReject(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(t.TempDir()),
+		xxljob.WithCallbackInterval("10ms"),
+		xxljob.WithConcurrencyPolicy(xxljob.ConcurrencyReject),
+	)
+	defer e.Stop()
+
+	release := make(chan struct{})
+	e.AddJobHandler("single", func(ctx context.Context, param xxljob.JobParam) error {
+		<-release
+		return nil
+	}, xxljob.WithMaxConcurrency(1))
+
+	trigger := func(jobID int, logID int64) error {
+		return e.TriggerJob(xxljob.RunParam{
+			JobID:           jobID,
+			ExecutorHandler: "single",
+			LogID:           logID,
+			LogDateTime:     time.Now().UnixNano() / int64(time.Millisecond),
+		})
+	}
+
+	should.NoError(trigger(1, 1))
+	should.EqualError(trigger(2, 2), "handler single is busy, its limit of 1 running jobs is reached")
+
+	close(release)
+	should.Equal(int64(1), (<-callbacks).LogID)
+	should.Empty(callbacks)
+}
@@ -6,6 +6,7 @@ package xxljob
 import (
 	"bufio"
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,6 +17,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	resty "github.com/go-resty/resty/v2"
@@ -28,6 +30,10 @@ const (
 
 	successCode = 200
 	failureCode = 500
+	timeoutCode = 502
+
+	// how long to wait for the cancelled jobs to exit during shutdown
+	cancelGracePeriod = time.Second
 )
 
 // Executor is responsible for executing jobs.
@@ -36,28 +42,59 @@ type Executor struct {
 
 	registry *RegistryParam
 	cli      *resty.Client
+	mux      *http.ServeMux
 	srv      *http.Server
-	// key is handler name, value is handler func
+	// key is handler name, value is *registeredHandler
 	handlers sync.Map
-	// current running jobs. key is job id, value is job instance.
-	// if a job is finished, it should be removed from this map.
-	jobs         sync.Map
-	callbackChan chan CallbackParam
-	notifier     *scheduler.Scheduler
-	registrar    *scheduler.Scheduler
-	cleaner      *scheduler.Scheduler
+	// middlewares applied to all the job handlers, guarded by mu.
+	middlewares []Middleware
+	// compiled glue sources. key is job id, the least recently used one is evicted if there are too many.
+	glues   map[int]*compiledGlue
+	gluesMu sync.Mutex
+	// job queues. key is job id, value is the FIFO queue of the jobs with this id.
+	// if a queue becomes empty, it should be removed from this map.
+	queues           map[int]*jobQueue
+	mu               sync.Mutex
+	running          int            // number of running jobs
+	runningByHandler map[string]int // number of running jobs of each handler
+	waiting          []*Job         // jobs waiting for a slot because of the concurrency limits
+	lastLocalLogID   int64          // log id of the last local job run by RunNow
+	stopping         bool           // whether the executor is shutting down
+	child            bool           // whether the process is a child process running an isolated handler
+	drained          chan struct{}  // closed when the executor is shutting down and there is no job left
+	watchers         sync.WaitGroup
+	stopOnce         sync.Once
+	stopErr          error
+	callbackChan     chan CallbackParam
+	spool            *callbackSpool
+	metrics          *metrics // nil if metrics are disabled
+	history          *history // nil if the execution history is disabled
+
+	// health state
+	createdAt      time.Time
+	lastRegistered int64        // unix nano of the last successful registration, accessed atomically
+	serverState    atomic.Value // state of the http server started by Start
+	notifier       *scheduler.Scheduler
+	registrar      *scheduler.Scheduler
+	cleaner        *scheduler.Scheduler
 }
 
 // NewExecutor creates a new executor.
 func NewExecutor(opts ...Option) *Executor {
 	e := &Executor{
 		Options: NewOptions(opts...),
+		queues:  make(map[int]*jobQueue),
+		glues:   make(map[int]*compiledGlue),
+
+		runningByHandler: make(map[string]int),
+		drained:          make(chan struct{}),
+		createdAt:        time.Now(),
 	}
 
 	e.registry = &RegistryParam{
 		RegistryGroup: "EXECUTOR",
 		RegistryKey:   e.AppName,
-		RegistryValue: fmt.Sprintf("http://%s:%d", LocalIP(), e.Port),
+		RegistryValue: fmt.Sprintf("http://%s:%d%s", LocalIP(), e.Port, e.PathPrefix),
 	}
 
 	// Init http client.
@@ -69,10 +106,15 @@ func NewExecutor(opts ...Option) *Executor {
 		e.cli.SetHeader(accessTokenHeader, e.AccessToken)
 	}
 
+	if e.Metrics {
+		e.metrics = newMetrics()
+	}
+
 	// Init http server.
 	e.setupRoutes()
 	e.srv = &http.Server{
 		Addr:         fmt.Sprintf(":%d", e.Port),
+		Handler:      e.mux,
 		IdleTimeout:  e.IdleTimeout,
 		ReadTimeout:  e.ReadTimeout,
 		WriteTimeout: e.WriteTimeout,
@@ -80,6 +122,19 @@ func NewExecutor(opts ...Option) *Executor {
 
 	// Send result notifications to xxl-job server periodically.
 	e.callbackChan = make(chan CallbackParam, e.CallbackBufferSize)
+
+	// The child process only runs an isolated handler, it must not talk to xxl-job server.
+	if isIsolatedChild() {
+		e.child = true
+		return e
+	}
+
+	if e.CallbackSpool {
+		e.setupSpool()
+	}
+	if e.HistorySize > 0 {
+		e.setupHistory()
+	}
 	e.notifier = scheduler.New("xxljob_callback", e.notifyResult, e.CallbackInterval)
 	e.notifier.Start()
 
@@ -94,9 +149,39 @@ func NewExecutor(opts ...Option) *Executor {
 	return e
 }
 
+// setupSpool creates the callback spool, the callbacks left by last run will be replayed.
+// If the spool cannot be created, the callbacks are kept in memory only.
+func (e *Executor) setupSpool() {
+	dir := e.CallbackSpoolDir
+	if dir == "" {
+		if e.LogDir == "" {
+			e.Logger.Error(logPrefix + "callback spool is disabled since neither spool dir nor log dir is configured")
+			return
+		}
+		dir = filepath.Join(e.LogDir, "callback")
+	}
+
+	spool, err := newCallbackSpool(dir, e.CallbackSpoolSize, e.CallbackSpoolOverflow)
+	if err != nil {
+		e.Logger.Error(logPrefix+"create callback spool failed: %v", err)
+		return
+	}
+
+	if n := spool.count(); n > 0 {
+		e.Logger.Info(logPrefix+"replay %d callbacks from spool", n)
+	}
+	e.spool = spool
+}
+
 // post conduct a post request and parse the response.
 func (e *Executor) post(endpoint string, data interface{}, res interface{}) error {
-	resp, err := e.cli.R().SetBody(data).SetResult(res).Post(endpoint)
+	ctx, span := e.tracer().Start(context.Background(), "xxljob.admin "+endpoint, SpanKindClient,
+		Attr("http.method", http.MethodPost),
+		Attr("http.url", e.Host+endpoint),
+	)
+	defer span.End()
+
+	resp, err := e.cli.R().SetContext(ctx).SetBody(data).SetResult(res).Post(endpoint)
 
 	body := resp.String()
 	size := resp.Size()
@@ -104,6 +189,8 @@ func (e *Executor) post(endpoint string, data interface{}, res interface{}) erro
 		body = "omitted"
 	}
 
+	e.metrics.observeRequest(endpoint, resp.Time())
+
 	e.Logger.Info(logPrefix+"[%d][%s][%s] url: %s, res: %s",
 		resp.StatusCode(),
 		ReadableSize(size),
@@ -112,6 +199,15 @@ func (e *Executor) post(endpoint string, data interface{}, res interface{}) erro
 		body,
 	)
 
+	if err == nil && resp.IsError() {
+		err = fmt.Errorf("unexpected http status %d", resp.StatusCode())
+	}
+
+	span.SetAttributes(Attr("http.status_code", resp.StatusCode()))
+	if err != nil {
+		span.RecordError(err)
+	}
+
 	return err
 }
 
@@ -123,6 +219,10 @@ func (e *Executor) register() error {
 	if err != nil {
 		e.Logger.Error(logPrefix+"register executor failed: %v", err)
 	}
+	e.metrics.registered(err)
+	if err == nil {
+		atomic.StoreInt64(&e.lastRegistered, time.Now().UnixNano())
+	}
 
 	return err
 }
@@ -161,14 +261,75 @@ func (e *Executor) callback(callbacks []CallbackParam) error {
 		}
 
 		e.Logger.Error(logPrefix+"callback transient error (attempt=%d/%d): %v", attempt+1, maxRetries, err)
+		e.metrics.callbackFailed()
 		time.Sleep(time.Duration(attempt+1) * baseDelay)
 	}
 
 	return err
 }
 
+// pushCallback puts the callback into the spool if it is enabled, otherwise into the callback queue.
+func (e *Executor) pushCallback(cb CallbackParam) {
+	if e.spool != nil {
+		dropped, err := e.spool.put(cb)
+		if err == nil {
+			if dropped != nil {
+				e.Logger.Error(logPrefix+"callback spool is full, drop the callback of log %d", dropped.LogID)
+			}
+			return
+		}
+		e.Logger.Error(logPrefix+"spool callback failed, keep it in memory: %v", err)
+	}
+
+	e.callbackChan <- cb
+}
+
+// deliverSpool sends the spooled callbacks to xxl-job server in batches until the spool is empty.
+// After a failed delivery, the next try is delayed with exponential backoff.
+func (e *Executor) deliverSpool() error {
+	s := e.spool
+	if time.Now().Before(s.nextTry) {
+		return nil
+	}
+
+	for {
+		entries := s.peek(spoolBatchSize)
+		if len(entries) == 0 {
+			return nil
+		}
+
+		callbacks := make([]CallbackParam, len(entries))
+		for i, entry := range entries {
+			callbacks[i] = entry.param
+		}
+
+		// A rejection, e.g. a wrong access token during token rotation, may be temporary,
+		// so the callbacks are kept in the spool until xxl-job server acknowledges them.
+		var res Response
+		err := e.post("/api/callback", callbacks, &res)
+		if err == nil && res.Code != successCode {
+			err = fmt.Errorf("callbacks are rejected: %s", res.Msg)
+		}
+		if err != nil {
+			e.metrics.callbackFailed()
+			delay := s.backoff()
+			e.Logger.Error(logPrefix+"deliver spooled callbacks failed, retry in %s: %v", delay, err)
+			return err
+		}
+
+		s.ack(entries)
+		s.reset()
+	}
+}
+
 // notifyResult sends job execution results to xxl-job server asynchronously.
 func (e *Executor) notifyResult() error {
+	if e.spool != nil {
+		if err := e.deliverSpool(); err != nil {
+			return err
+		}
+	}
+
 	var callbacks []CallbackParam
 
 Drain:
@@ -233,6 +394,8 @@ func (e *Executor) cleanupLogs() error {
 
 // Start starts the executor and register itself to the xxl-job server.
 func (e *Executor) Start() error {
+	e.RunIsolated()
+
 	if err := e.register(); err != nil {
 		return err
 	}
@@ -241,49 +404,128 @@ func (e *Executor) Start() error {
 	errChan := make(chan error, 1)
 	go func() {
 		e.Logger.Info("http server listen and serve on :%d", e.Port)
-		errChan <- e.srv.ListenAndServe()
+		e.serverState.Store(serverServing)
+		err := e.srv.ListenAndServe()
+		e.serverState.Store(serverClosed)
+		errChan <- err
 	}()
 
 	// Intercept interrupt signals.
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, e.interruptSignals...)
+	defer signal.Stop(sigChan)
 
 	// Wait for error or shutdown signal.
 	select {
-	// If http server fail to start.
+	// If http server fail to start, or it is closed by Stop.
 	case err := <-errChan:
+		if err == http.ErrServerClosed {
+			return nil
+		}
 		e.Logger.Error("fail to start http server: %s", err.Error())
 		return err
-	// If we receive an interrupt signal, gracefully shutdown server.
+	// If we receive an interrupt signal, gracefully shutdown the executor.
 	case sig := <-sigChan:
 		e.Logger.Info("interrupt signal received: %v", sig)
-
-		// Create a deadline to wait for graceful shutdown.
-		ctx, cancel := context.WithTimeout(context.Background(), e.WaitTimeout)
-		defer cancel()
-
-		return e.srv.Shutdown(ctx)
+		return e.Stop()
 	}
 }
 
-// Stop stops the executor.
+// Stop gracefully stops the executor. It rejects new jobs and fails the readiness,
+// deregisters the executor after ShutdownDelay,
+// waits up to WaitTimeout for the running and queued jobs to finish, cancels the remaining ones,
+// flushes the pending callbacks to xxl-job server, and finally shuts down the http server.
+// It is safe to call Stop multiple times.
 func (e *Executor) Stop() error {
+	e.stopOnce.Do(func() {
+		if e.child {
+			return
+		}
+		e.stopErr = e.shutdown()
+	})
+
+	return e.stopErr
+}
+
+// shutdown stops the executor in order.
+func (e *Executor) shutdown() error {
+	// Fail the readiness probe and reject new jobs, then give the probes ShutdownDelay to notice it
+	// before deregistering, so that no new traffic is routed here.
+	e.mu.Lock()
+	e.stopping = true
+	e.mu.Unlock()
+	time.Sleep(e.ShutdownDelay)
+
 	e.registrar.Stop()
 	_ = e.deregister()
 
-	e.jobs.Range(func(k interface{}, v interface{}) bool {
-		job := v.(*Job)
-		e.stopJob(job)
-		return true
-	})
+	e.drain()
+	e.history.close()
 
-	// close(e.callbackChan)
+	// Stop the notifier first so that it will not send callbacks concurrently, then flush the rest.
+	// The callbacks which still fail to be delivered are kept in the spool for the next run.
 	e.notifier.Stop()
+	if e.spool != nil {
+		e.spool.reset()
+	}
+	if err := e.notifyResult(); err != nil {
+		e.Logger.Error(logPrefix+"flush callbacks failed: %v", err)
+	}
+
 	if e.cleaner != nil {
 		e.cleaner.Stop()
 	}
 
-	return nil
+	ctx, cancel := context.WithTimeout(context.Background(), e.WaitTimeout)
+	defer cancel()
+
+	return e.srv.Shutdown(ctx)
+}
+
+// drain waits for the existing jobs to finish after the executor starts stopping.
+// The jobs which are still running after WaitTimeout will be cancelled.
+func (e *Executor) drain() {
+	e.mu.Lock()
+	e.checkDrained()
+	e.mu.Unlock()
+
+	select {
+	case <-e.drained:
+	case <-time.After(e.WaitTimeout):
+		e.Logger.Info(logPrefix + "wait timeout, cancel the remaining jobs")
+		e.mu.Lock()
+		for id := range e.queues {
+			e.killJobs(id, CauseShutdown)
+		}
+		e.mu.Unlock()
+	}
+
+	// Wait for the results of the finished and cancelled jobs to be pushed into the callback queue.
+	done := make(chan struct{})
+	go func() {
+		e.watchers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(cancelGracePeriod):
+		e.Logger.Error(logPrefix + "some jobs do not exit after being cancelled, their results are lost")
+	}
+}
+
+// checkDrained closes the drained channel if the executor is shutting down and there is no job left.
+// The caller must hold e.mu.
+func (e *Executor) checkDrained() {
+	if !e.stopping || len(e.queues) > 0 {
+		return
+	}
+
+	select {
+	case <-e.drained:
+	default:
+		close(e.drained)
+	}
 }
 
 // GetJobHandler retrieves the job handler for a given name.
@@ -293,12 +535,25 @@ func (e *Executor) GetJobHandler(name string) JobHandler {
 		return nil
 	}
 
-	return v.(JobHandler)
+	return v.(*registeredHandler).handler
+}
+
+// GetHandlerOptions retrieves the options of the job handler for a given name.
+func (e *Executor) GetHandlerOptions(name string) (HandlerOptions, bool) {
+	v, ok := e.handlers.Load(name)
+	if !ok {
+		return HandlerOptions{}, false
+	}
+
+	return v.(*registeredHandler).options, true
 }
 
 // AddJobHandler registers a job handler by name.
-func (e *Executor) AddJobHandler(name string, h JobHandler) {
-	e.handlers.Store(name, h)
+// The handler options are enforced on every job of the handler, e.g.
+//
+//	e.AddJobHandler("demo", demo, xxljob.WithMaxTimeout(60), xxljob.WithBlockStrategy(xxljob.DiscardLater))
+func (e *Executor) AddJobHandler(name string, h JobHandler, opts ...HandlerOption) {
+	e.handlers.Store(name, newRegisteredHandler(h, opts...))
 }
 
 // RemoveJobHandler removes a job handler by name.
@@ -309,25 +564,55 @@ func (e *Executor) RemoveJobHandler(name string) {
 // TriggerJob triggers a job.
 // It will return error if handler does not exist or log id is duplicate.
 func (e *Executor) TriggerJob(params RunParam) error {
-	// Check if there is a job with same id running.
-	job := e.getJob(params.JobID)
-	if job != nil && job.LogID == params.LogID {
-		return errors.New("duplicate log id")
+	_, err := e.triggerJob(params, false)
+
+	return err
+}
+
+// triggerJob triggers a job, whose result is reported to xxl-job server unless it is local.
+// The log id of a local job is generated.
+func (e *Executor) triggerJob(params RunParam, local bool) (*Job, error) {
+	// Resolve the handler before taking e.mu, since compiling the glue source may take a while.
+	handler, err := e.jobHandler(params)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.stopping {
+		return nil, errors.New("executor is shutting down")
+	}
+
+	if local {
+		params.LogID = e.nextLocalLogID()
 	}
 
+	if params.GlueType == "" || params.GlueType == GlueBean {
+		if options, ok := e.GetHandlerOptions(params.ExecutorHandler); ok {
+			options.apply(&params)
+		}
+	}
+
+	// Check if there is a job with same log id running or pending.
+	q := e.queues[params.JobID]
+	if q != nil && q.find(params.LogID) != nil {
+		return nil, errors.New("duplicate log id")
+	}
+	idle := q == nil || q.size() == 0
+
 	switch params.ExecutorBlockStrategy {
 	case DiscardLater:
 		// If there is a job with same id running, this request will be discarded and marked as failed.
-		if job != nil {
-			e.Logger.Info(logPrefix+"[%d:%d] is still running", job.ID, job.LogID)
-			return errors.New("a job of same id is already running")
+		if q != nil && q.size() > 0 {
+			e.Logger.Info(logPrefix+"[%d:%d] is still running", params.JobID, params.LogID)
+			return nil, errors.New("a job of same id is already running")
 		}
 	case CoverEarly:
-		// If there is a job with same id running, we will terminate it,
+		// If there is a job with same id running, we will terminate it and clear the queue,
 		// and then creates and runs a new one.
-		if job != nil {
-			e.stopJob(job)
-		}
+		e.killJobs(params.JobID, CauseCoverEarly)
 		fallthrough
 	case SerialExecution:
 		// Default mode, put the job into the FIFO queue and runs in serial mode.
@@ -335,116 +620,361 @@ func (e *Executor) TriggerJob(params RunParam) error {
 	default:
 	}
 
-	newJob, err := e.newJob(params)
-	if err != nil {
-		return err
+	// A job queued behind the jobs of the same id is never rejected, it waits for a slot instead.
+	if e.ConcurrencyPolicy == ConcurrencyReject && idle {
+		if e.isBusy() {
+			return nil, errors.New("executor is busy, too many running jobs")
+		}
+		if name, limit := jobName(params), e.maxConcurrency(params); !e.hasSlot(name, limit) {
+			return nil, fmt.Errorf("handler %s is busy, its limit of %d running jobs is reached", name, limit)
+		}
 	}
-	go e.runJob(newJob)
 
-	return nil
+	newJob := e.newJob(params, handler, local)
+	e.enqueueJob(newJob)
+
+	return newJob, nil
 }
 
-// getJob tries to get the current running job by id.
-func (e *Executor) getJob(id int) *Job {
-	v, ok := e.jobs.Load(id)
+// QueuedJobs returns the snapshots of the pending jobs of the given job id in the order of execution.
+func (e *Executor) QueuedJobs(id int) []JobStatus {
+	now := time.Now()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	q, ok := e.queues[id]
 	if !ok {
 		return nil
 	}
 
-	return v.(*Job)
+	jobs := make([]JobStatus, 0, len(q.pending))
+	for i, job := range q.pending {
+		jobs = append(jobs, e.jobStatus(job, now, i+1))
+	}
+
+	return jobs
+}
+
+// CancelQueuedJob removes a pending job from the queue and reports it as failed.
+// It returns false if the job is not found in the queue.
+func (e *Executor) CancelQueuedJob(id int, logID int64) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	q, ok := e.queues[id]
+	if !ok {
+		return false
+	}
+
+	job := q.remove(logID)
+	if job == nil {
+		return false
+	}
+
+	e.Logger.Info(logPrefix+"[%d:%d] queued job is cancelled", job.ID, job.LogID)
+	e.discardJob(job, CauseCancelled)
+
+	return true
+}
+
+// isIdle checks if there is no running or pending job of the given id.
+func (e *Executor) isIdle(id int) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	q, ok := e.queues[id]
+
+	return !ok || q.size() == 0
+}
+
+// busy checks if a new job has to wait for a slot because of the global concurrency limit.
+func (e *Executor) busy() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.isBusy()
+}
+
+// hasJob checks if the job with the given log id is running or pending.
+func (e *Executor) hasJob(logID int64) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, q := range e.queues {
+		if q.find(logID) != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// killJob stops the running job and clears the queue of the given id.
+func (e *Executor) killJob(id int, cause CancelCause) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.killJobs(id, cause)
+}
+
+// killJobs stops the running job and discards all the pending jobs of the given id.
+// The caller must hold e.mu.
+func (e *Executor) killJobs(id int, cause CancelCause) {
+	q, ok := e.queues[id]
+	if !ok {
+		return
+	}
+
+	if job := q.running; job != nil {
+		e.Logger.Info(logPrefix+"[%d:%d] job is stopped and removed: %s", job.ID, job.LogID, cause.message())
+		if e.removeWaiting(job) {
+			e.discardJob(job, cause)
+		} else {
+			job.stop(cause)
+		}
+		q.running = nil
+	}
+
+	for _, job := range q.pending {
+		e.Logger.Info(logPrefix+"[%d:%d] queued job is removed: %s", job.ID, job.LogID, cause.message())
+		e.discardJob(job, cause)
+	}
+	q.pending = nil
+
+	e.removeQueue(id)
+}
+
+// discardJob finishes a job which has never been run.
+func (e *Executor) discardJob(job *Job, cause CancelCause) {
+	job.stop(cause)
+	job.done <- errors.New(cause.message())
+}
+
+// enqueueJob puts the job into the queue of its job id, and runs it if the queue is idle.
+// The caller must hold e.mu.
+func (e *Executor) enqueueJob(job *Job) {
+	q, ok := e.queues[job.ID]
+	if !ok {
+		q = new(jobQueue)
+		e.queues[job.ID] = q
+	}
+
+	q.pending = append(q.pending, job)
+	if q.running != nil {
+		e.Logger.Info(logPrefix+"[%d:%d] job is queued, position: %d", job.ID, job.LogID, len(q.pending))
+		return
+	}
+
+	e.runNext(job.ID, q)
 }
 
-// addJob saves the current running job in the job map.
-func (e *Executor) addJob(job *Job) {
-	e.jobs.Store(job.ID, job)
+// runNext runs the first pending job in the queue, or removes the queue if it is empty.
+// The caller must hold e.mu.
+func (e *Executor) runNext(id int, q *jobQueue) {
+	job := q.pop()
+	if job == nil {
+		e.removeQueue(id)
+		return
+	}
+
+	// The job blocks the queue even if it is waiting for a slot.
+	q.running = job
+	e.startJob(job)
 }
 
-// stopJob stops and removes a job.
-func (e *Executor) stopJob(job *Job) {
-	e.Logger.Info(logPrefix+"[%d:%d] job is stopped and removed", job.ID, job.LogID)
-	job.Stop()
-	e.jobs.Delete(job.ID)
+// removeQueue removes the empty queue of the given id.
+// The caller must hold e.mu.
+func (e *Executor) removeQueue(id int) {
+	delete(e.queues, id)
+	e.checkDrained()
 }
 
-// newJob creates a new job instance and starts watching its execution.
-func (e *Executor) newJob(params RunParam) (*Job, error) {
-	handler := e.GetJobHandler(params.ExecutorHandler)
-	if handler == nil {
-		return nil, errors.New("job handler not found")
+// finishJob removes the finished job from its queue and runs the next one.
+func (e *Executor) finishJob(job *Job) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.releaseSlot(job)
+
+	// The job may have been killed and removed from the queue already.
+	q, ok := e.queues[job.ID]
+	if !ok || q.running != job {
+		return
 	}
 
+	q.running = nil
+	e.runNext(job.ID, q)
+}
+
+// newJob creates a new job instance of the handler and starts watching its execution.
+func (e *Executor) newJob(params RunParam, handler JobHandler, local bool) *Job {
+	middlewares := e.middlewares
+	if e.retryRetryable(params) {
+		// Only the errors marked as retryable are retried.
+		policy := e.RetryPolicy
+		policy.RetryIf = IsRetryable
+		middlewares = append(append([]Middleware{}, middlewares...), policy.Middleware())
+	}
+	handler = Chain(handler, middlewares...)
+
 	param := JobParam{
 		Params:        params.ExecutorParams,
 		ShardingIndex: params.BroadcastIndex,
 		ShardingTotal: params.BroadcastTotal,
+		JobID:         params.JobID,
+		LogID:         params.LogID,
+		LogDateTime:   params.LogDateTime,
+		TriggerTime:   time.Unix(0, params.LogDateTime*int64(time.Millisecond)),
+		Handler:       params.ExecutorHandler,
+		BlockStrategy: params.ExecutorBlockStrategy,
+		Timeout:       params.ExecutorTimeout,
 	}
 
 	job := &Job{
-		ID:          params.JobID,
-		LogID:       params.LogID,
-		LogDateTime: params.LogDateTime,
-		Name:        params.ExecutorHandler,
-		Handle:      handler,
-		Param:       param,
-		Timeout:     params.ExecutorTimeout,
-		LogDir:      e.LogDir,
-		done:        make(chan error, 1),
+		ID:           params.JobID,
+		LogID:        params.LogID,
+		LogDateTime:  params.LogDateTime,
+		Name:         jobName(params),
+		Handle:       handler,
+		Param:        param,
+		Timeout:      params.ExecutorTimeout,
+		LogDir:       e.LogDir,
+		FatalOnPanic: e.FatalOnPanic,
+		Tracer:       e.Tracer,
+
+		done:           make(chan error, 1),
+		maxConcurrency: e.maxConcurrency(params),
+		local:          local,
+	}
+	if local {
+		job.result = make(chan RunResult, 1)
 	}
+	job.ctx, job.cancel = context.WithCancel(context.Background())
 
+	e.watchers.Add(1)
 	go e.watch(job)
 
-	return job, nil
+	return job
 }
 
 // watch waits for the job execution result and push it to the callback queue.
 func (e *Executor) watch(job *Job) {
+	defer e.watchers.Done()
+
 	err := <-job.done
 
 	job.EndTime = time.Now()
 
-	// Remove the current job after execution finished.
-	e.jobs.Delete(job.ID)
+	// Remove the current job after execution finished, and run the next one in the queue.
+	e.finishJob(job)
 
 	cb := CallbackParam{
 		LogID:       job.LogID,
 		LogDateTime: time.Now().UnixNano() / int64(time.Millisecond),
 	}
 
+	cb.HandleCode, cb.HandleMsg = handleResult(job, err)
+	e.metrics.observeJob(job.Name, jobOutcome(job, err), job.Duration())
+	e.recordExecution(job, err, cb.HandleCode, cb.HandleMsg)
 	if err != nil {
-		e.Logger.Error(logPrefix+"[%d:%d][%s] job handler failed: %v", job.ID, job.LogID, job.Duration(), err)
-		cb.HandleCode = failureCode
-		cb.HandleMsg = err.Error()
+		e.Logger.Error(logPrefix+"[%d:%d][%s] job handler failed: %s", job.ID, job.LogID, job.Duration(), cb.HandleMsg)
 	} else {
 		e.Logger.Info(logPrefix+"[%d:%d][%s] job handler succeeded", job.ID, job.LogID, job.Duration())
-		cb.HandleCode = successCode
-		cb.HandleMsg = "OK"
 	}
-	e.callbackChan <- cb
+
+	if job.local {
+		job.result <- RunResult{
+			LogID:       job.LogID,
+			LogDateTime: job.LogDateTime,
+			HandleCode:  cb.HandleCode,
+			HandleMsg:   cb.HandleMsg,
+			Duration:    job.Duration(),
+		}
+		return
+	}
+	e.pushCallback(cb)
 }
 
-func (e *Executor) runJob(job *Job) {
-	// wait for old job to finish before starting the new job
-	st := time.Now()
-	for {
-		if oldJob := e.getJob(job.ID); oldJob == nil {
-			break
+// handleResult converts the job execution result into the handle code and message of callback.
+// The stopped and timed out jobs are reported distinctly so that they can be told from the failed ones.
+func handleResult(job *Job, err error) (int, string) {
+	if err == nil {
+		return successCode, "OK"
+	}
+
+	switch cause := job.cancelCause(); cause {
+	case CauseNone:
+		return failureCode, err.Error()
+	case CauseTimeout:
+		return timeoutCode, fmt.Sprintf("%s after %ds: %v", cause.message(), job.Timeout, err)
+	default:
+		if job.StartTime.IsZero() {
+			return failureCode, cause.message() + ", job not executed"
 		}
-		time.Sleep(time.Second)
-		e.Logger.Info(logPrefix+"[%d:%d] waiting for old job to finish, time elapsed: %s", job.ID, job.LogID, TruncateDuration(time.Since(st)))
+		return failureCode, cause.message()
 	}
-	e.addJob(job)
-	e.Logger.Info(logPrefix+"[%d:%d] job starts", job.ID, job.LogID)
-	job.Run()
 }
 
 /* Below are methods for serving http api */
 
 func (e *Executor) setupRoutes() {
-	http.HandleFunc("/beat", e.beat)
-	http.HandleFunc("/idleBeat", e.idleBeat)
-	http.HandleFunc("/run", e.trigger)
-	http.HandleFunc("/kill", e.kill)
-	http.HandleFunc("/log", e.log)
+	e.mux = http.NewServeMux()
+	e.mux.HandleFunc(e.PathPrefix+"/beat", e.authorize(e.beat))
+	e.mux.HandleFunc(e.PathPrefix+"/idleBeat", e.authorize(e.idleBeat))
+	e.mux.HandleFunc(e.PathPrefix+"/run", e.authorize(e.trigger))
+	e.mux.HandleFunc(e.PathPrefix+"/kill", e.authorize(e.kill))
+	e.mux.HandleFunc(e.PathPrefix+"/log", e.authorize(e.log))
+	e.mux.HandleFunc(e.PathPrefix+"/runNow", e.authorize(e.runNow))
+	e.mux.HandleFunc(e.PathPrefix+"/status", e.authorize(e.status))
+	e.mux.HandleFunc(e.PathPrefix+"/history", e.authorize(e.serveHistory))
+
+	// Prometheus and the probes do not send the access token.
+	e.mux.HandleFunc(e.PathPrefix+"/healthz", e.healthz)
+	e.mux.HandleFunc(e.PathPrefix+"/readyz", e.readyz)
+	if e.metrics != nil {
+		e.mux.HandleFunc(e.PathPrefix+"/metrics", e.serveMetrics)
+	}
+}
+
+// Handler returns the http handler serving the executor endpoints,
+// so that the executor can be mounted into an existing http server instead of calling Start.
+// The endpoints are served under Options.PathPrefix.
+func (e *Executor) Handler() http.Handler {
+	return e.mux
+}
+
+// authorize rejects the requests whose access token does not match any of the accepted tokens.
+// If no token is configured, all requests are allowed.
+func (e *Executor) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !e.validToken(r.Header.Get(accessTokenHeader)) {
+			e.Logger.Error(logPrefix+"invalid access token from %s on %s", r.RemoteAddr, r.URL.Path)
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintln(w, NewErrorResponse("the access token is wrong").String())
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// validToken checks if the given token is accepted.
+func (e *Executor) validToken(token string) bool {
+	tokens := append([]string{e.AccessToken}, e.AccessTokens...)
+
+	configured := false
+	for _, t := range tokens {
+		if t == "" {
+			continue
+		}
+		configured = true
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return true
+		}
+	}
+
+	return !configured
 }
 
 func (e *Executor) parseParam(r *http.Request, param interface{}) error {
@@ -478,8 +1008,14 @@ func (e *Executor) idleBeat(w http.ResponseWriter, r *http.Request) {
 
 	e.Logger.Info(logPrefix+"check idle of job %d", param.JobID)
 
-	if e.getJob(param.JobID) != nil {
-		fmt.Fprintln(w, NewErrorResponse("job is running").String())
+	if !e.isIdle(param.JobID) {
+		fmt.Fprintln(w, NewErrorResponse("job is running or has trigger queue").String())
+		return
+	}
+
+	// Let xxl-job server pick another executor if the job would wait for a slot here.
+	if e.busy() {
+		fmt.Fprintln(w, NewErrorResponse("executor is busy, too many running jobs").String())
 		return
 	}
 
@@ -519,9 +1055,7 @@ func (e *Executor) kill(w http.ResponseWriter, r *http.Request) {
 
 	e.Logger.Info(logPrefix+"killing job %d", param.JobID)
 
-	if job := e.getJob(param.JobID); job != nil {
-		e.stopJob(job)
-	}
+	e.killJob(param.JobID, CauseKilled)
 
 	fmt.Fprintln(w, NewSuccResponse().String())
 }
@@ -560,15 +1094,10 @@ func (e *Executor) log(w http.ResponseWriter, r *http.Request) {
 			toLineNum = line
 		}
 
-		// If job still running, mark IsEnd false so admin keeps polling.
-		e.jobs.Range(func(_, v interface{}) bool {
-			job := v.(*Job)
-			if job.LogID == param.LogId {
-				isEnd = false
-				return false
-			}
-			return true
-		})
+		// If job still running or pending, mark IsEnd false so admin keeps polling.
+		if e.hasJob(param.LogId) {
+			isEnd = false
+		}
 	} else {
 		logContent = "log directory not configured"
 	}
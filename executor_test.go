@@ -4,6 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -29,6 +33,25 @@ func timestampMS() int64 {
 	return time.Now().UnixNano() / int64(time.Millisecond)
 }
 
+// newFakeAdmin starts a fake xxl-job server which records the callbacks.
+func newFakeAdmin() (*httptest.Server, chan xxljob.CallbackParam) {
+	callbacks := make(chan xxljob.CallbackParam, 100)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/callback" {
+			var params []xxljob.CallbackParam
+			_ = json.NewDecoder(r.Body).Decode(&params)
+			for _, p := range params {
+				callbacks <- p
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, xxljob.NewSuccResponse().String())
+	}))
+
+	return srv, callbacks
+}
+
 // TestExecutorTestSuite runs the ljob client test suite.
 func TestExecutorTestSuite(t *testing.T) {
 	suite.Run(t, new(ExecutorTestSuite))
@@ -40,6 +63,7 @@ func (ts *ExecutorTestSuite) SetupSuite() {
 	ts.e = xxljob.NewExecutor(
 		xxljob.WithAppName(appName),
 		xxljob.WithAccessToken(accessToken),
+		xxljob.WithAccessTokens("next_token"),
 		xxljob.WithClientTimeout(time.Second),
 		xxljob.WithHost(host),
 		xxljob.WithLogRetentionDays(1),
@@ -90,7 +114,9 @@ func (ts *ExecutorTestSuite) TearDownSuite() {
 func (ts *ExecutorTestSuite) TestHappyPath() {
 	should := require.New(ts.T())
 
-	cli := resty.New().SetBaseURL(fmt.Sprintf("http://localhost:%d", ts.e.Port))
+	cli := resty.New().
+		SetBaseURL(fmt.Sprintf("http://localhost:%d", ts.e.Port)).
+		SetHeader("XXL-JOB-ACCESS-TOKEN", accessToken)
 
 	resp, err := cli.R().Get("beat")
 	should.NoError(err)
@@ -211,7 +237,9 @@ func (ts *ExecutorTestSuite) TestHappyPath() {
 func (ts *ExecutorTestSuite) TestInvalidRequest() {
 	should := require.New(ts.T())
 
-	cli := resty.New().SetBaseURL(fmt.Sprintf("http://localhost:%d", ts.e.Port))
+	cli := resty.New().
+		SetBaseURL(fmt.Sprintf("http://localhost:%d", ts.e.Port)).
+		SetHeader("XXL-JOB-ACCESS-TOKEN", accessToken)
 
 	var res xxljob.Response
 
@@ -224,3 +252,323 @@ func (ts *ExecutorTestSuite) TestInvalidRequest() {
 		should.Equal(500, res.Code)
 	}
 }
+
+func (ts *ExecutorTestSuite) TestAccessToken() {
+	should := require.New(ts.T())
+
+	cli := resty.New().SetBaseURL(fmt.Sprintf("http://localhost:%d", ts.e.Port))
+
+	var res xxljob.Response
+
+	tests := []struct {
+		token string
+		code  int
+	}{
+		{"", 500},
+		{"wrong_token", 500},
+		{accessToken, 200},
+		{"next_token", 200},
+	}
+
+	for _, tt := range tests {
+		resp, err := cli.R().SetHeader("XXL-JOB-ACCESS-TOKEN", tt.token).Get("beat")
+		should.NoError(err)
+		err = json.Unmarshal(resp.Body(), &res)
+		should.NoError(err)
+		should.Equal(tt.code, res.Code, tt.token)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	should := require.New(t)
+
+	// multiple executors can live in one process
+	e1 := xxljob.NewExecutor(xxljob.WithLogger(xxljob.DummyLogger()))
+	defer e1.Stop()
+
+	e2 := xxljob.NewExecutor(
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithPathPrefix("xxl-job/"),
+	)
+	defer e2.Stop()
+
+	srv := httptest.NewServer(e2.Handler())
+	defer srv.Close()
+
+	cli := resty.New().
+		SetBaseURL(srv.URL).
+		SetHeader("XXL-JOB-ACCESS-TOKEN", accessToken)
+
+	resp, err := cli.R().Get("/xxl-job/beat")
+	should.NoError(err)
+
+	var res xxljob.Response
+	err = json.Unmarshal(resp.Body(), &res)
+	should.NoError(err)
+	should.Equal(200, res.Code)
+
+	resp, err = cli.R().Get("/beat")
+	should.NoError(err)
+	should.Equal(http.StatusNotFound, resp.StatusCode())
+}
+
+func TestSerialExecution(t *testing.T) {
+	should := require.New(t)
+
+	e := xxljob.NewExecutor(
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(""),
+	)
+	defer e.Stop()
+
+	release := make(chan struct{})
+	started := make(chan string, 10)
+	stopped := make(chan string, 10)
+	results := make(chan string, 10)
+	e.AddJobHandler("serialHandler", func(ctx context.Context, param xxljob.JobParam) error {
+		started <- param.Params
+		select {
+		case <-release:
+		case <-ctx.Done():
+			stopped <- param.Params
+			return ctx.Err()
+		}
+		results <- param.Params
+		return nil
+	})
+
+	trigger := func(logID int64, strategy string) error {
+		return e.TriggerJob(xxljob.RunParam{
+			JobID:                 1,
+			ExecutorHandler:       "serialHandler",
+			ExecutorParams:        fmt.Sprint(logID),
+			ExecutorBlockStrategy: strategy,
+			LogID:                 logID,
+			LogDateTime:           timestampMS(),
+		})
+	}
+
+	for i := int64(1); i <= 4; i++ {
+		should.NoError(trigger(i, xxljob.SerialExecution))
+	}
+	should.Error(trigger(2, xxljob.SerialExecution)) // duplicate log id in the queue
+	should.Error(trigger(5, xxljob.DiscardLater))
+
+	queued := e.QueuedJobs(1)
+	should.Len(queued, 3)
+	should.Equal(int64(2), queued[0].LogID)
+	should.Equal(xxljob.JobQueued, queued[0].State)
+	should.Equal(3, queued[2].QueuePosition)
+
+	should.True(e.CancelQueuedJob(1, 3))
+	should.False(e.CancelQueuedJob(1, 3))
+	should.Len(e.QueuedJobs(1), 2)
+
+	// jobs run one by one in the order of arrival
+	for _, want := range []string{"1", "2", "4"} {
+		should.Equal(want, <-started)
+		release <- struct{}{}
+		should.Equal(want, <-results)
+	}
+
+	// cover early kills the running job and clears the queue
+	should.NoError(trigger(6, xxljob.SerialExecution))
+	should.Equal("6", <-started)
+	should.NoError(trigger(7, xxljob.SerialExecution))
+	should.NoError(trigger(8, xxljob.CoverEarly))
+	should.Empty(e.QueuedJobs(1))
+	should.Equal("6", <-stopped)
+	should.Equal("8", <-started)
+
+	release <- struct{}{}
+	should.Equal("8", <-results)
+}
+
+func TestPanicRecovery(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	logDir := t.TempDir()
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(logDir),
+		xxljob.WithCallbackInterval("10ms"),
+	)
+	defer e.Stop()
+
+	e.AddJobHandler("panicHandler", func(ctx context.Context, param xxljob.JobParam) error {
+		panic("something wrong")
+	})
+
+	now := time.Now()
+	err := e.TriggerJob(xxljob.RunParam{
+		JobID:           1,
+		ExecutorHandler: "panicHandler",
+		LogID:           1,
+		LogDateTime:     now.UnixNano() / int64(time.Millisecond),
+	})
+	should.NoError(err)
+
+	cb := <-callbacks
+	should.Equal(int64(1), cb.LogID)
+	should.Equal(500, cb.HandleCode)
+	should.Equal("job handler panic: something wrong", cb.HandleMsg)
+
+	b, err := os.ReadFile(filepath.Join(logDir, now.Format("2006-01-02"), "1.log"))
+	should.NoError(err)
+	should.Contains(string(b), "job panic: something wrong")
+	should.Contains(string(b), "goroutine")
+}
+
+func TestGracefulStop(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(""),
+		xxljob.WithCallbackInterval("1h"),
+		xxljob.WithWaitTimeout(time.Millisecond*500),
+	)
+
+	e.AddJobHandler("shortHandler", func(ctx context.Context, param xxljob.JobParam) error {
+		time.Sleep(time.Millisecond * 100)
+		return nil
+	})
+	e.AddJobHandler("longHandler", func(ctx context.Context, param xxljob.JobParam) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	should.NoError(e.TriggerJob(xxljob.RunParam{JobID: 1, ExecutorHandler: "shortHandler", LogID: 1}))
+	should.NoError(e.TriggerJob(xxljob.RunParam{JobID: 2, ExecutorHandler: "longHandler", LogID: 2}))
+
+	should.NoError(e.Stop())
+	should.NoError(e.Stop())
+	should.Error(e.TriggerJob(xxljob.RunParam{JobID: 3, ExecutorHandler: "shortHandler", LogID: 3}))
+
+	// the results are flushed before Stop returns
+	results := make(map[int64]int)
+	for len(callbacks) > 0 {
+		cb := <-callbacks
+		results[cb.LogID] = cb.HandleCode
+	}
+	should.Equal(map[int64]int{1: 200, 2: 500}, results)
+}
+
+func TestHandleCode(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(""),
+		xxljob.WithCallbackInterval("10ms"),
+		xxljob.WithWaitTimeout(time.Millisecond*100),
+	)
+
+	srv := httptest.NewServer(e.Handler())
+	defer srv.Close()
+
+	causes := make(chan string, 10)
+	e.AddJobHandler("blockHandler", func(ctx context.Context, param xxljob.JobParam) error {
+		<-ctx.Done()
+		causes <- fmt.Sprintf("%s:%s", param.Params, xxljob.CancelCauseFromContext(ctx))
+		return ctx.Err()
+	})
+
+	run := func(jobID int, logID int64, strategy string, timeout int) {
+		should.NoError(e.TriggerJob(xxljob.RunParam{
+			JobID:                 jobID,
+			ExecutorHandler:       "blockHandler",
+			ExecutorParams:        fmt.Sprint(logID),
+			ExecutorBlockStrategy: strategy,
+			ExecutorTimeout:       timeout,
+			LogID:                 logID,
+		}))
+	}
+
+	run(1, 1, xxljob.SerialExecution, 1)
+	run(2, 2, xxljob.SerialExecution, 0)
+	run(3, 3, xxljob.SerialExecution, 0)
+	run(3, 4, xxljob.SerialExecution, 0)
+	run(3, 5, xxljob.CoverEarly, 0)
+
+	_, err := resty.New().R().
+		SetHeader("XXL-JOB-ACCESS-TOKEN", accessToken).
+		SetBody(xxljob.KillParam{JobID: 2}).
+		Post(srv.URL + "/kill")
+	should.NoError(err)
+
+	time.Sleep(time.Millisecond * 1200)
+	should.NoError(e.Stop())
+
+	results := make(map[int64]xxljob.CallbackParam)
+	for len(callbacks) > 0 {
+		cb := <-callbacks
+		results[cb.LogID] = cb
+	}
+
+	should.Equal(502, results[1].HandleCode)
+	should.Equal("job execution timeout after 1s: context deadline exceeded", results[1].HandleMsg)
+	should.Equal(500, results[2].HandleCode)
+	should.Equal("job killed by xxl-job server", results[2].HandleMsg)
+	should.Equal("job killed by block strategy COVER_EARLY", results[3].HandleMsg)
+	should.Equal("job killed by block strategy COVER_EARLY, job not executed", results[4].HandleMsg)
+	should.Equal("job killed by executor shutdown", results[5].HandleMsg)
+
+	should.Len(causes, 4)
+	should.ElementsMatch([]string{"1:TIMEOUT", "2:KILLED", "3:COVER_EARLY", "5:SHUTDOWN"},
+		[]string{<-causes, <-causes, <-causes, <-causes})
+	should.Equal(xxljob.CauseNone, xxljob.CancelCauseFromContext(context.Background()))
+}
+
+func TestJobParam(t *testing.T) {
+	should := require.New(t)
+
+	e := xxljob.NewExecutor(
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(""),
+	)
+	defer e.Stop()
+
+	params := make(chan xxljob.JobParam, 1)
+	e.AddJobHandler("paramHandler", func(ctx context.Context, param xxljob.JobParam) error {
+		params <- param
+		return nil
+	})
+
+	now := timestampMS()
+	should.NoError(e.TriggerJob(xxljob.RunParam{
+		JobID:                 1,
+		ExecutorHandler:       "paramHandler",
+		ExecutorParams:        "a=1",
+		ExecutorBlockStrategy: xxljob.DiscardLater,
+		ExecutorTimeout:       10,
+		LogID:                 2,
+		LogDateTime:           now,
+		BroadcastIndex:        1,
+		BroadcastTotal:        3,
+	}))
+
+	param := <-params
+	should.Equal("a=1", param.Params)
+	should.Equal(1, param.ShardingIndex)
+	should.Equal(3, param.ShardingTotal)
+	should.Equal(1, param.JobID)
+	should.Equal(int64(2), param.LogID)
+	should.Equal(now, param.LogDateTime)
+	should.Equal(now, param.TriggerTime.UnixNano()/int64(time.Millisecond))
+	should.Equal("paramHandler", param.Handler)
+	should.Equal(xxljob.DiscardLater, param.BlockStrategy)
+	should.Equal(10, param.Timeout)
+}
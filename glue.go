@@ -0,0 +1,311 @@
+package xxljob
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// GlueBean: the job is run by the job handler registered in the executor. (default)
+	GlueBean = "BEAN"
+	// GlueShell: the glue source is run as a shell script.
+	GlueShell = "GLUE_SHELL"
+	// GluePython: the glue source is run as a python script.
+	GluePython = "GLUE_PYTHON"
+	// GluePHP: the glue source is run as a php script.
+	GluePHP = "GLUE_PHP"
+	// GlueNodeJS: the glue source is run as a nodejs script.
+	GlueNodeJS = "GLUE_NODEJS"
+	// GluePowerShell: the glue source is run as a powershell script.
+	GluePowerShell = "GLUE_POWERSHELL"
+	// GlueGo: the glue source is go code compiled into a job handler by the GlueCompiler registered for it.
+	GlueGo = "GLUE_GO"
+)
+
+// GlueCompiler compiles the glue source into a job handler.
+type GlueCompiler func(source string) (JobHandler, error)
+
+// maxLineSize is the max size of a line read from the output of a process.
+const maxLineSize = 1 << 20
+
+// maxCompiledGlues is the max number of compiled glue sources cached in the executor.
+const maxCompiledGlues = 256
+
+// compiledGlue is a compiled glue source of a job.
+type compiledGlue struct {
+	version  int64 // glue update time
+	handler  JobHandler
+	lastUsed time.Time
+}
+
+// defaultGlueCommands returns the interpreter commands of the script glue types, same as the java executor.
+func defaultGlueCommands() map[string][]string {
+	return map[string][]string{
+		GlueShell:      {"bash"},
+		GluePython:     {"python"},
+		GluePHP:        {"php"},
+		GlueNodeJS:     {"node"},
+		GluePowerShell: {"powershell"},
+	}
+}
+
+// defaultGlueDir returns the default directory to save the glue source files in the cache directory of the user,
+// which is not writable by other users unlike /tmp.
+func defaultGlueDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = "."
+	}
+
+	return filepath.Join(dir, "xxl-job", "gluesource")
+}
+
+// glueExtensions are the script file extensions of the glue types.
+var glueExtensions = map[string]string{
+	GlueShell:      ".sh",
+	GluePython:     ".py",
+	GluePHP:        ".php",
+	GlueNodeJS:     ".js",
+	GluePowerShell: ".ps1",
+}
+
+// jobHandler returns the handler to run the job, which is either a registered handler or a glue script.
+func (e *Executor) jobHandler(params RunParam) (JobHandler, error) {
+	switch params.GlueType {
+	case "", GlueBean:
+		handler := e.GetJobHandler(params.ExecutorHandler)
+		if handler == nil {
+			return nil, errors.New("job handler not found")
+		}
+		if e.isIsolated(params.ExecutorHandler) {
+			return e.isolatedHandler(params.ExecutorHandler), nil
+		}
+		return handler, nil
+	}
+
+	if compiler, ok := e.GlueCompilers[params.GlueType]; ok {
+		return e.compileGlue(params, compiler)
+	}
+
+	command := e.GlueCommands[params.GlueType]
+	if len(command) == 0 {
+		return nil, fmt.Errorf("glue type %s is not supported", params.GlueType)
+	}
+
+	return e.scriptHandler(command, params), nil
+}
+
+// compileGlue compiles the glue source of the job into a handler.
+// The compiled handler is cached until the glue source of the job is updated.
+func (e *Executor) compileGlue(params RunParam, compiler GlueCompiler) (JobHandler, error) {
+	e.gluesMu.Lock()
+	glue, ok := e.glues[params.JobID]
+	if ok && glue.version == params.GlueUpdatetime {
+		glue.lastUsed = time.Now()
+		e.gluesMu.Unlock()
+		return glue.handler, nil
+	}
+	e.gluesMu.Unlock()
+
+	handler, err := compiler(params.GlueSource)
+	if err != nil {
+		return nil, fmt.Errorf("compile glue source failed: %w", err)
+	}
+
+	e.gluesMu.Lock()
+	defer e.gluesMu.Unlock()
+
+	e.glues[params.JobID] = &compiledGlue{version: params.GlueUpdatetime, handler: handler, lastUsed: time.Now()}
+	if len(e.glues) > maxCompiledGlues {
+		e.evictGlue()
+	}
+
+	return handler, nil
+}
+
+// evictGlue removes the least recently used compiled glue source.
+// The caller must hold e.gluesMu.
+func (e *Executor) evictGlue() {
+	oldest := -1
+	for id, glue := range e.glues {
+		if oldest == -1 || glue.lastUsed.Before(e.glues[oldest].lastUsed) {
+			oldest = id
+		}
+	}
+
+	delete(e.glues, oldest)
+}
+
+// glueFile writes the glue source into a script file in the workspace of the job and returns its path.
+// The file is named by glue update time, and it is always rewritten from the glue source,
+// so that a file planted in the workspace is never run.
+func (e *Executor) glueFile(params RunParam, ext string) (string, error) {
+	workspace := filepath.Join(e.GlueDir, strconv.Itoa(params.JobID))
+	if err := privateDir(e.GlueDir); err != nil {
+		return "", err
+	}
+	if err := privateDir(workspace); err != nil {
+		return "", err
+	}
+
+	name := strconv.FormatInt(params.GlueUpdatetime, 10) + ext
+	file := filepath.Join(workspace, name)
+
+	if err := writeFileAtomic(file, []byte(params.GlueSource), 0700); err != nil {
+		return "", err
+	}
+
+	// Remove the old versions of the script, other files in the workspace are left untouched.
+	if entries, err := os.ReadDir(workspace); err == nil {
+		for _, entry := range entries {
+			old := entry.Name()
+			if old != name && !entry.IsDir() && isGlueVersion(old) {
+				_ = os.Remove(filepath.Join(workspace, old))
+			}
+		}
+	}
+
+	return file, nil
+}
+
+// privateDir creates the directory with 0700 permissions if it does not exist.
+// An existing directory is restricted to 0700 too, which fails if it is owned by another user.
+func privateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	return os.Chmod(dir, 0700)
+}
+
+// isGlueVersion checks if the file name is a script version named by glue update time.
+func isGlueVersion(name string) bool {
+	version := strings.TrimSuffix(name, filepath.Ext(name))
+	_, err := strconv.ParseInt(version, 10, 64)
+
+	return err == nil
+}
+
+// scriptHandler returns a handler which writes the glue source into a script file when the job runs,
+// and runs the script file by the command in the directory of the script.
+// Same as the java executor, the params and sharding info are passed to the script as arguments,
+// and they are also available in the environment variables.
+func (e *Executor) scriptHandler(command []string, params RunParam) JobHandler {
+	return func(ctx context.Context, param JobParam) error {
+		// The script is written by the job itself, so that the disk I/O is not done while triggering,
+		// and a queued job never finds its script removed by a newer version.
+		file, err := e.glueFile(params, glueExtensions[params.GlueType])
+		if err != nil {
+			return err
+		}
+
+		args := append([]string{}, command[1:]...)
+		args = append(args,
+			file,
+			param.Params,
+			strconv.Itoa(param.ShardingIndex),
+			strconv.Itoa(param.ShardingTotal),
+		)
+
+		cmd := exec.Command(command[0], args...)
+		cmd.Dir = filepath.Dir(file)
+		cmd.Env = append(os.Environ(),
+			"XXL_JOB_ID="+strconv.Itoa(param.JobID),
+			"XXL_JOB_LOG_ID="+strconv.FormatInt(param.LogID, 10),
+			"XXL_JOB_PARAMS="+param.Params,
+			"XXL_JOB_SHARD_INDEX="+strconv.Itoa(param.ShardingIndex),
+			"XXL_JOB_SHARD_TOTAL="+strconv.Itoa(param.ShardingTotal),
+		)
+
+		return runCommand(ctx, cmd)
+	}
+}
+
+// runCommand runs the command in a new process group and writes its output into the job log line by line.
+// If the context is done, the whole process group will be killed.
+func runCommand(ctx context.Context, cmd *exec.Cmd) error {
+	logger := LoggerFromContext(ctx)
+
+	setProcessGroup(cmd)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	logger.Info("script process started: pid=%d", cmd.Process.Pid)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := killProcessGroup(cmd); err != nil {
+				logger.Error("kill script process failed: %v", err)
+			}
+		case <-done:
+		}
+	}()
+
+	// The pipes must be drained before calling Wait.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go pipeLines(&wg, stdout, func(line string) { logger.Info("%s", line) })
+	go pipeLines(&wg, stderr, func(line string) { logger.Error("%s", line) })
+	wg.Wait()
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("script exit code %d", exitErr.ExitCode())
+	}
+
+	return err
+}
+
+// pipeLines reads the output of a process line by line.
+// A line longer than maxLineSize is split, so that the rest of the output is never lost.
+func pipeLines(wg *sync.WaitGroup, r io.Reader, fn func(line string)) {
+	defer wg.Done()
+
+	reader := bufio.NewReader(r)
+	var line []byte
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			if len(line) > 0 {
+				fn(string(line))
+			}
+			return
+		}
+
+		line = append(line, chunk...)
+		if isPrefix && len(line) < maxLineSize {
+			continue
+		}
+
+		fn(string(line))
+		line = line[:0]
+	}
+}
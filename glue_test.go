@@ -0,0 +1,221 @@
+package xxljob_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hyperjiang/xxljob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlueShell(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	logDir := t.TempDir()
+	glueDir := t.TempDir()
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(logDir),
+		xxljob.WithGlueDir(glueDir),
+		xxljob.WithDefaultGlueCommands(),
+		xxljob.WithCallbackInterval("10ms"),
+	)
+	defer e.Stop()
+
+	now := time.Now()
+	runGlue := func(jobID int, logID int64, glueType, source string, timeout int) xxljob.CallbackParam {
+		should.NoError(e.TriggerJob(xxljob.RunParam{
+			JobID:           jobID,
+			ExecutorParams:  "hello",
+			ExecutorTimeout: timeout,
+			LogID:           logID,
+			LogDateTime:     now.UnixNano() / int64(time.Millisecond),
+			GlueType:        glueType,
+			GlueSource:      source,
+			GlueUpdatetime:  logID,
+			BroadcastIndex:  1,
+			BroadcastTotal:  2,
+		}))
+		return <-callbacks
+	}
+	run := func(jobID int, logID int64, source string, timeout int) xxljob.CallbackParam {
+		return runGlue(jobID, logID, xxljob.GlueShell, source, timeout)
+	}
+
+	// a script planted in the workspace is overwritten by the glue source
+	should.NoError(os.MkdirAll(filepath.Join(glueDir, "1"), 0755))
+	should.NoError(os.WriteFile(filepath.Join(glueDir, "1", "1.sh"), []byte("exit 7"), 0755))
+
+	cb := run(1, 1, "echo \"params: $1 $2 $3 $XXL_JOB_LOG_ID\"\necho oops >&2", 0)
+	should.Equal(200, cb.HandleCode)
+
+	b, err := os.ReadFile(filepath.Join(logDir, now.Format("2006-01-02"), "1.log"))
+	should.NoError(err)
+	should.Contains(string(b), "[INFO] params: hello 1 2 1")
+	should.Contains(string(b), "[ERROR] oops")
+
+	info, err := os.Stat(filepath.Join(glueDir, "1"))
+	should.NoError(err)
+	should.Equal(os.FileMode(0700), info.Mode().Perm())
+
+	cb = run(1, 2, "exit 3", 0)
+	should.Equal(500, cb.HandleCode)
+	should.Equal("script exit code 3", cb.HandleMsg)
+
+	// only the latest version of the glue source is kept in the workspace
+	files, err := os.ReadDir(filepath.Join(glueDir, "1"))
+	should.NoError(err)
+	should.Len(files, 1)
+	should.Equal("2.sh", files[0].Name())
+
+	// the child processes are killed on timeout
+	st := time.Now()
+	cb = run(2, 3, "sleep 30 &\nwait", 1)
+	should.Equal(502, cb.HandleCode)
+	should.Less(int64(time.Since(st)), int64(time.Second*3))
+
+	should.Error(e.TriggerJob(xxljob.RunParam{JobID: 3, LogID: 4, GlueType: "GLUE_GROOVY"}))
+
+	if _, err := exec.LookPath("python"); err == nil {
+		cb = runGlue(4, 5, xxljob.GluePython, "import sys\nsys.exit(0 if sys.argv[1] == 'hello' else 1)", 0)
+		should.Equal(200, cb.HandleCode, cb.HandleMsg)
+	}
+
+	if _, err := exec.LookPath("node"); err == nil {
+		cb = runGlue(5, 6, xxljob.GlueNodeJS, "process.exit(process.env.XXL_JOB_SHARD_TOTAL === '2' ? 0 : 1)", 0)
+		should.Equal(200, cb.HandleCode, cb.HandleMsg)
+	}
+}
+
+func TestGlueDisabledByDefault(t *testing.T) {
+	should := require.New(t)
+
+	e := xxljob.NewExecutor(
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(""),
+		xxljob.WithGlueDir(t.TempDir()),
+	)
+	defer e.Stop()
+
+	err := e.TriggerJob(xxljob.RunParam{JobID: 1, LogID: 1, GlueType: xxljob.GlueShell, GlueSource: "echo hello"})
+	should.EqualError(err, "glue type GLUE_SHELL is not supported")
+}
+
+func TestGlueCompiler(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	compiled := 0
+	compiler := func(source string) (xxljob.JobHandler, error) {
+		if source == "" {
+			return nil, errors.New("empty source")
+		}
+		compiled++
+		return func(ctx context.Context, param xxljob.JobParam) error {
+			if source != param.Params {
+				return errors.New("unexpected source")
+			}
+			return nil
+		}, nil
+	}
+
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(""),
+		xxljob.WithGlueCompiler(xxljob.GlueGo, compiler),
+		xxljob.WithCallbackInterval("10ms"),
+	)
+	defer e.Stop()
+
+	run := func(logID int64, source string, version int64) error {
+		return e.TriggerJob(xxljob.RunParam{
+			JobID:          1,
+			ExecutorParams: source,
+			LogID:          logID,
+			GlueType:       xxljob.GlueGo,
+			GlueSource:     source,
+			GlueUpdatetime: version,
+		})
+	}
+
+	// the compiled handler is cached until the glue source is updated
+	should.NoError(run(1, "v1", 1))
+	should.Equal(200, (<-callbacks).HandleCode)
+	should.NoError(run(2, "v1", 1))
+	should.Equal(200, (<-callbacks).HandleCode)
+	should.Equal(1, compiled)
+
+	should.NoError(run(3, "v2", 2))
+	should.Equal(200, (<-callbacks).HandleCode)
+	should.Equal(2, compiled)
+
+	should.Error(run(4, "", 3))
+
+	// the least recently used compiled glue is evicted if there are too many
+	for id := 2; id <= 257; id++ {
+		should.NoError(e.TriggerJob(xxljob.RunParam{
+			JobID:          id,
+			ExecutorParams: "v1",
+			LogID:          int64(100 + id),
+			GlueType:       xxljob.GlueGo,
+			GlueSource:     "v1",
+			GlueUpdatetime: 1,
+		}))
+		should.Equal(200, (<-callbacks).HandleCode)
+	}
+	should.Equal(258, compiled)
+	should.NoError(run(5, "v2", 2))
+	should.Equal(200, (<-callbacks).HandleCode)
+	should.Equal(259, compiled)
+}
+
+func TestGlueCompileOutsideLock(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	compiling := make(chan struct{})
+	release := make(chan struct{})
+	compiler := func(source string) (xxljob.JobHandler, error) {
+		close(compiling)
+		<-release
+		return func(ctx context.Context, param xxljob.JobParam) error { return nil }, nil
+	}
+
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(""),
+		xxljob.WithGlueCompiler(xxljob.GlueGo, compiler),
+		xxljob.WithCallbackInterval("10ms"),
+	)
+	defer e.Stop()
+
+	triggered := make(chan error, 1)
+	go func() {
+		triggered <- e.TriggerJob(xxljob.RunParam{JobID: 1, LogID: 1, GlueType: xxljob.GlueGo, GlueSource: "v1", GlueUpdatetime: 1})
+	}()
+	<-compiling
+
+	// the executor is not blocked while the glue source is being compiled
+	e.AddJobHandler("demo", func(ctx context.Context, param xxljob.JobParam) error { return nil })
+	should.NoError(e.TriggerJob(xxljob.RunParam{JobID: 2, LogID: 2, ExecutorHandler: "demo"}))
+	should.Equal(int64(2), (<-callbacks).LogID)
+
+	close(release)
+	should.NoError(<-triggered)
+	should.Equal(int64(1), (<-callbacks).LogID)
+}
@@ -1,9 +1,16 @@
 module github.com/hyperjiang/xxljob
 
-go 1.16
+go 1.18
 
 require (
 	github.com/go-resty/resty/v2 v2.7.0
 	github.com/hyperjiang/scheduler v1.0.0
 	github.com/stretchr/testify v1.8.2
 )
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/net v0.0.0-20211029224645-99673261e6eb // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,187 @@
+package xxljob
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+	"unicode"
+)
+
+// HandlerOptions are the options of a job handler set by the code owner at registration time,
+// they take precedence over the settings sent by xxl-job server.
+type HandlerOptions struct {
+	Description    string
+	Timeout        int          // default timeout in seconds if xxl-job server sends none
+	MaxTimeout     int          // max timeout in seconds, enforced even if xxl-job server sends none
+	BlockStrategy  string       // overrides the block strategy sent by xxl-job server
+	MaxConcurrency int          // max number of jobs of the handler running at the same time, 0 means no limit
+	RetryPolicy    *RetryPolicy // retry policy of the handler, the executor RetryPolicy is used for retryable errors if nil
+	Middlewares    []Middleware // middlewares of the handler, wrapped by the ones added by Executor.Use
+}
+
+// HandlerOption is for setting handler options.
+type HandlerOption func(*HandlerOptions)
+
+// WithDescription sets the description of the handler.
+func WithDescription(desc string) HandlerOption {
+	return func(o *HandlerOptions) {
+		o.Description = desc
+	}
+}
+
+// WithDefaultTimeout sets the timeout in seconds which is used if xxl-job server sends none.
+func WithDefaultTimeout(seconds int) HandlerOption {
+	return func(o *HandlerOptions) {
+		o.Timeout = seconds
+	}
+}
+
+// WithMaxTimeout sets the max timeout in seconds of the handler.
+// It is enforced even if xxl-job server sends no timeout or a larger one.
+func WithMaxTimeout(seconds int) HandlerOption {
+	return func(o *HandlerOptions) {
+		o.MaxTimeout = seconds
+	}
+}
+
+// WithBlockStrategy overrides the block strategy sent by xxl-job server.
+func WithBlockStrategy(strategy string) HandlerOption {
+	return func(o *HandlerOptions) {
+		o.BlockStrategy = strategy
+	}
+}
+
+// WithMaxConcurrency sets the max number of jobs of the handler running at the same time,
+// including the jobs of different job ids. The others wait until a slot is free,
+// or are rejected if the ConcurrencyPolicy of the executor is ConcurrencyReject.
+func WithMaxConcurrency(n int) HandlerOption {
+	return func(o *HandlerOptions) {
+		o.MaxConcurrency = n
+	}
+}
+
+// WithRetry retries the handler up to attempts times in total if it fails, waiting for delay between attempts.
+func WithRetry(attempts int, delay time.Duration) HandlerOption {
+	return WithRetryPolicy(RetryPolicy{MaxAttempts: attempts, InitialDelay: delay})
+}
+
+// WithRetryPolicy sets the retry policy of the handler.
+func WithRetryPolicy(policy RetryPolicy) HandlerOption {
+	return func(o *HandlerOptions) {
+		o.RetryPolicy = &policy
+	}
+}
+
+// WithMiddlewares adds middlewares to the handler.
+func WithMiddlewares(middlewares ...Middleware) HandlerOption {
+	return func(o *HandlerOptions) {
+		o.Middlewares = append(o.Middlewares, middlewares...)
+	}
+}
+
+// registeredHandler is a job handler registered in the executor.
+type registeredHandler struct {
+	handler JobHandler // the handler wrapped by its middlewares
+	options HandlerOptions
+}
+
+// newRegisteredHandler applies the handler options to the handler.
+func newRegisteredHandler(h JobHandler, opts ...HandlerOption) *registeredHandler {
+	var options HandlerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	middlewares := append([]Middleware{}, options.Middlewares...)
+	if options.RetryPolicy != nil {
+		middlewares = append(middlewares, options.RetryPolicy.Middleware())
+	}
+
+	return &registeredHandler{
+		handler: Chain(h, middlewares...),
+		options: options,
+	}
+}
+
+// apply overrides the run params sent by xxl-job server with the handler options.
+func (o HandlerOptions) apply(params *RunParam) {
+	if o.BlockStrategy != "" {
+		params.ExecutorBlockStrategy = o.BlockStrategy
+	}
+
+	if params.ExecutorTimeout <= 0 && o.Timeout > 0 {
+		params.ExecutorTimeout = o.Timeout
+	}
+
+	if o.MaxTimeout > 0 && (params.ExecutorTimeout <= 0 || params.ExecutorTimeout > o.MaxTimeout) {
+		params.ExecutorTimeout = o.MaxTimeout
+	}
+}
+
+// HandlerProvider is implemented by the objects which provide their job handlers explicitly to RegisterHandlers.
+type HandlerProvider interface {
+	Handlers() map[string]JobHandler
+}
+
+var jobHandlerType = reflect.TypeOf((func(context.Context, JobParam) error)(nil))
+
+// RegisterHandlers registers the job handlers of obj with the handler options.
+// If obj implements HandlerProvider, its Handlers are registered, otherwise all the exported methods
+// with the same signature as JobHandler are registered by their names in lower camel case,
+// e.g. the method SyncOrders is registered as "syncOrders".
+// Unlike AddJobHandler, it fails if a handler name is already registered, and nothing is registered in that case.
+func (e *Executor) RegisterHandlers(obj interface{}, opts ...HandlerOption) error {
+	handlers := make(map[string]JobHandler)
+	if provider, ok := obj.(HandlerProvider); ok {
+		handlers = provider.Handlers()
+	} else {
+		v := reflect.ValueOf(obj)
+		for i := 0; i < v.NumMethod(); i++ {
+			method := v.Method(i)
+			if method.Type() != jobHandlerType {
+				continue
+			}
+
+			name := handlerName(v.Type().Method(i).Name)
+			handlers[name] = method.Interface().(func(context.Context, JobParam) error)
+		}
+	}
+
+	if len(handlers) == 0 {
+		return fmt.Errorf("no job handler found in %T", obj)
+	}
+
+	names := make([]string, 0, len(handlers))
+	for name := range handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		if _, loaded := e.handlers.LoadOrStore(name, newRegisteredHandler(handlers[name], opts...)); loaded {
+			// Roll back the handlers registered by this call.
+			for _, registered := range names[:i] {
+				e.handlers.Delete(registered)
+			}
+			return fmt.Errorf("job handler %q is already registered", name)
+		}
+	}
+
+	return nil
+}
+
+// handlerName converts the method name into lower camel case, e.g. SyncOrders to syncOrders and ETLJob to etlJob.
+func handlerName(method string) string {
+	runes := []rune(method)
+	for i := 0; i < len(runes) && unicode.IsUpper(runes[i]); i++ {
+		// Keep the last upper case letter of an acronym, which starts the next word.
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+
+	return string(runes)
+}
@@ -0,0 +1,189 @@
+package xxljob_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hyperjiang/xxljob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerOptions(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(t.TempDir()),
+		xxljob.WithCallbackInterval("10ms"),
+	)
+	defer e.Stop()
+
+	var params = make(chan xxljob.JobParam, 10)
+	e.AddJobHandler("hang", func(ctx context.Context, param xxljob.JobParam) error {
+		params <- param
+		<-ctx.Done()
+		return ctx.Err()
+	},
+		xxljob.WithDescription("hang until cancelled"),
+		xxljob.WithMaxTimeout(1),
+		xxljob.WithBlockStrategy(xxljob.DiscardLater),
+	)
+
+	var calls int32
+	e.AddJobHandler("flaky", func(ctx context.Context, param xxljob.JobParam) error {
+		params <- param
+		if atomic.AddInt32(&calls, 1) < 2 {
+			return errors.New("flaky")
+		}
+		return nil
+	},
+		xxljob.WithDefaultTimeout(10),
+		xxljob.WithRetry(2, time.Millisecond),
+		xxljob.WithMaxConcurrency(1),
+	)
+
+	opts, ok := e.GetHandlerOptions("hang")
+	should.True(ok)
+	should.Equal("hang until cancelled", opts.Description)
+	_, ok = e.GetHandlerOptions("unknown")
+	should.False(ok)
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+
+	// The max timeout is enforced even if xxl-job server sends no timeout,
+	// and the block strategy is overridden.
+	should.NoError(e.TriggerJob(xxljob.RunParam{
+		JobID:                 1,
+		ExecutorHandler:       "hang",
+		ExecutorBlockStrategy: xxljob.SerialExecution,
+		LogID:                 1,
+		LogDateTime:           now,
+	}))
+	param := <-params
+	should.Equal(1, param.Timeout)
+	should.Equal(xxljob.DiscardLater, param.BlockStrategy)
+
+	should.Error(e.TriggerJob(xxljob.RunParam{
+		JobID:                 1,
+		ExecutorHandler:       "hang",
+		ExecutorBlockStrategy: xxljob.SerialExecution,
+		LogID:                 2,
+		LogDateTime:           now,
+	}))
+
+	cb := <-callbacks
+	should.Equal(int64(1), cb.LogID)
+	should.Equal(502, cb.HandleCode)
+
+	// A larger timeout sent by xxl-job server is capped too.
+	should.NoError(e.TriggerJob(xxljob.RunParam{
+		JobID:           1,
+		ExecutorHandler: "hang",
+		ExecutorTimeout: 100,
+		LogID:           3,
+		LogDateTime:     now,
+	}))
+	should.Equal(1, (<-params).Timeout)
+	should.Equal(502, (<-callbacks).HandleCode)
+
+	// The default timeout is used if xxl-job server sends none, and the handler is retried.
+	should.NoError(e.TriggerJob(xxljob.RunParam{
+		JobID:           2,
+		ExecutorHandler: "flaky",
+		LogID:           4,
+		LogDateTime:     now,
+	}))
+	should.Equal(10, (<-params).Timeout)
+	<-params
+	cb = <-callbacks
+	should.Equal(int64(4), cb.LogID)
+	should.Equal(200, cb.HandleCode)
+	should.Equal(int32(2), atomic.LoadInt32(&calls))
+}
+
+type orderJobs struct {
+	synced chan string
+}
+
+func (o *orderJobs) SyncOrders(ctx context.Context, param xxljob.JobParam) error {
+	o.synced <- param.Params
+	return nil
+}
+
+func (o *orderJobs) ETLJob(ctx context.Context, param xxljob.JobParam) error {
+	return nil
+}
+
+func (o *orderJobs) URL(ctx context.Context, param xxljob.JobParam) error {
+	return nil
+}
+
+// Helper does not match the signature of JobHandler.
+func (o *orderJobs) Helper(ctx context.Context) error {
+	return nil
+}
+
+type providedJobs struct{}
+
+func (providedJobs) Handlers() map[string]xxljob.JobHandler {
+	return map[string]xxljob.JobHandler{
+		"provided": func(ctx context.Context, param xxljob.JobParam) error { return nil },
+		"urL":      func(ctx context.Context, param xxljob.JobParam) error { return nil },
+		"url":      func(ctx context.Context, param xxljob.JobParam) error { return nil },
+	}
+}
+
+func TestRegisterHandlers(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(t.TempDir()),
+		xxljob.WithCallbackInterval("10ms"),
+	)
+	defer e.Stop()
+
+	jobs := &orderJobs{synced: make(chan string, 1)}
+	should.NoError(e.RegisterHandlers(jobs, xxljob.WithDescription("order jobs")))
+	should.NotNil(e.GetJobHandler("syncOrders"))
+	should.NotNil(e.GetJobHandler("etlJob"))
+	should.NotNil(e.GetJobHandler("url"))
+	should.Nil(e.GetJobHandler("helper"))
+
+	opts, ok := e.GetHandlerOptions("syncOrders")
+	should.True(ok)
+	should.Equal("order jobs", opts.Description)
+
+	should.NoError(e.TriggerJob(xxljob.RunParam{
+		JobID:           1,
+		ExecutorHandler: "syncOrders",
+		ExecutorParams:  "hello",
+		LogID:           1,
+		LogDateTime:     time.Now().UnixNano() / int64(time.Millisecond),
+	}))
+	should.Equal(200, (<-callbacks).HandleCode)
+	should.Equal("hello", <-jobs.synced)
+
+	// Duplicates fail loudly and nothing is registered.
+	should.EqualError(e.RegisterHandlers(&orderJobs{}), `job handler "etlJob" is already registered`)
+	should.EqualError(e.RegisterHandlers(providedJobs{}), `job handler "url" is already registered`)
+	should.Nil(e.GetJobHandler("provided"))
+	should.Nil(e.GetJobHandler("urL"))
+
+	e.RemoveJobHandler("url")
+	should.NoError(e.RegisterHandlers(providedJobs{}))
+	should.NotNil(e.GetJobHandler("provided"))
+
+	should.EqualError(e.RegisterHandlers(struct{}{}), "no job handler found in struct {}")
+}
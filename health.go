@@ -0,0 +1,140 @@
+package xxljob
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// HealthOK: the executor is healthy or ready.
+	HealthOK = "ok"
+	// HealthUnavailable: the executor is unhealthy or not ready.
+	HealthUnavailable = "unavailable"
+
+	serverServing = "serving"
+	serverClosed  = "closed"
+
+	// how many register intervals without a successful registration make the executor not ready
+	registerMisses = 3
+)
+
+// HealthStatus is the result of the health or readiness check.
+type HealthStatus struct {
+	Status          string     `json:"status"`            // HealthOK or HealthUnavailable
+	Reasons         []string   `json:"reasons,omitempty"` // why the executor is unavailable
+	Server          string     `json:"server,omitempty"`  // state of the http server started by Start, empty if it is not started
+	ShuttingDown    bool       `json:"shuttingDown"`
+	LastRegistered  *time.Time `json:"lastRegistered,omitempty"` // last successful registration to xxl-job server
+	CallbackBacklog int        `json:"callbackBacklog"`          // number of callbacks waiting to be delivered
+}
+
+// Health checks if the executor is alive. Only the local state is checked, i.e. the http server started by Start
+// is not closed, so that an outage of xxl-job server never makes the executor restart.
+func (e *Executor) Health() HealthStatus {
+	status := e.healthStatus()
+
+	if status.Server == serverClosed {
+		status.Reasons = append(status.Reasons, "http server is closed")
+	}
+
+	return status.complete()
+}
+
+// Readiness checks if the executor is ready to run jobs. Besides being healthy, it must have registered to
+// xxl-job server successfully recently, must not be shutting down, and the callback backlog must not exceed
+// HealthMaxCallbackBacklog.
+func (e *Executor) Readiness() HealthStatus {
+	status := e.Health()
+
+	if status.ShuttingDown {
+		status.Reasons = append(status.Reasons, "executor is shutting down")
+	}
+	if status.LastRegistered == nil {
+		status.Reasons = append(status.Reasons, "executor is not registered yet")
+	} else if reason := e.checkRegistration(*status.LastRegistered); reason != "" {
+		status.Reasons = append(status.Reasons, reason)
+	}
+	if e.HealthMaxCallbackBacklog > 0 && status.CallbackBacklog > e.HealthMaxCallbackBacklog {
+		status.Reasons = append(status.Reasons, fmt.Sprintf("too many callbacks waiting: %d", status.CallbackBacklog))
+	}
+
+	return status.complete()
+}
+
+// healthStatus collects the state of the executor.
+func (e *Executor) healthStatus() HealthStatus {
+	e.mu.Lock()
+	stopping := e.stopping
+	e.mu.Unlock()
+
+	status := HealthStatus{
+		ShuttingDown:    stopping,
+		CallbackBacklog: len(e.callbackChan),
+	}
+
+	if v := e.serverState.Load(); v != nil {
+		status.Server = v.(string)
+	}
+	if ts := atomic.LoadInt64(&e.lastRegistered); ts > 0 {
+		t := time.Unix(0, ts)
+		status.LastRegistered = &t
+	}
+	if e.spool != nil {
+		status.CallbackBacklog += e.spool.count()
+	}
+
+	return status
+}
+
+// complete sets the status according to the reasons.
+func (s HealthStatus) complete() HealthStatus {
+	s.Status = HealthOK
+	if len(s.Reasons) > 0 {
+		s.Status = HealthUnavailable
+	}
+
+	return s
+}
+
+// checkRegistration returns why the last registration is considered stale, or empty if it is fine.
+func (e *Executor) checkRegistration(last time.Time) string {
+	timeout := e.HealthRegisterTimeout
+	if timeout <= 0 {
+		interval, err := time.ParseDuration(e.RegisterInterval)
+		if err != nil {
+			interval, _ = time.ParseDuration(defaultRegisterInterval)
+		}
+		timeout = interval * registerMisses
+	}
+
+	if since := time.Since(last); since > timeout {
+		return fmt.Sprintf("no successful registration in %s", since.Truncate(time.Second))
+	}
+
+	return ""
+}
+
+// healthz is for the liveness probe.
+func (e *Executor) healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, e.Health())
+}
+
+// readyz is for the readiness probe.
+func (e *Executor) readyz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, e.Readiness())
+}
+
+// writeHealth writes the status with 200 if it is ok, otherwise 503.
+func writeHealth(w http.ResponseWriter, status HealthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	if status.Status == HealthOK {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	_ = json.NewEncoder(w).Encode(status)
+}
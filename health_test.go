@@ -0,0 +1,146 @@
+package xxljob_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	resty "github.com/go-resty/resty/v2"
+	"github.com/hyperjiang/xxljob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealth(t *testing.T) {
+	should := require.New(t)
+
+	var e *xxljob.Executor
+	var down int32
+	readyOnDeregister := make(chan bool, 1)
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if r.URL.Path == "/api/registryRemove" {
+			readyOnDeregister <- e.Readiness().Status == xxljob.HealthOK
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, xxljob.NewSuccResponse().String())
+	}))
+	defer admin.Close()
+
+	e = xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(t.TempDir()),
+		xxljob.WithRegisterInterval("10ms"),
+		xxljob.WithHealthRegisterTimeout(time.Millisecond*200),
+		xxljob.WithShutdownDelay(time.Millisecond*300),
+	)
+
+	srv := httptest.NewServer(e.Handler())
+	defer srv.Close()
+
+	probe := func(path string) (int, xxljob.HealthStatus) {
+		// The probes do not require the access token.
+		resp, err := resty.New().R().Get(srv.URL + path)
+		should.NoError(err)
+		var status xxljob.HealthStatus
+		should.NoError(json.Unmarshal(resp.Body(), &status))
+		return resp.StatusCode(), status
+	}
+
+	should.Eventually(func() bool {
+		code, _ := probe("/readyz")
+		return code == http.StatusOK
+	}, time.Second, time.Millisecond*10)
+
+	code, status := probe("/healthz")
+	should.Equal(http.StatusOK, code)
+	should.Equal(xxljob.HealthOK, status.Status)
+	should.NotNil(status.LastRegistered)
+	should.False(status.ShuttingDown)
+
+	// An outage of xxl-job server fails the readiness only, the executor is still alive.
+	atomic.StoreInt32(&down, 1)
+	should.Eventually(func() bool {
+		code, _ := probe("/readyz")
+		return code == http.StatusServiceUnavailable
+	}, time.Second, time.Millisecond*10)
+	_, status = probe("/readyz")
+	should.Contains(status.Reasons[0], "no successful registration in")
+	code, _ = probe("/healthz")
+	should.Equal(http.StatusOK, code)
+
+	atomic.StoreInt32(&down, 0)
+	should.Eventually(func() bool {
+		code, _ := probe("/readyz")
+		return code == http.StatusOK
+	}, time.Second, time.Millisecond*10)
+
+	// The readiness fails for the shutdown delay before the executor is deregistered.
+	stopped := make(chan error, 1)
+	go func() { stopped <- e.Stop() }()
+	should.Eventually(func() bool {
+		code, _ := probe("/readyz")
+		return code == http.StatusServiceUnavailable
+	}, time.Second, time.Millisecond*10)
+	should.Empty(readyOnDeregister)
+	should.NoError(<-stopped)
+	should.False(<-readyOnDeregister)
+
+	code, status = probe("/readyz")
+	should.Equal(http.StatusServiceUnavailable, code)
+	should.Equal(xxljob.HealthUnavailable, status.Status)
+	should.True(status.ShuttingDown)
+	should.Contains(status.Reasons, "executor is shutting down")
+}
+
+func TestHealthRegistrationFailure(t *testing.T) {
+	should := require.New(t)
+
+	admin := httptest.NewServer(http.NotFoundHandler())
+	admin.Close()
+
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(t.TempDir()),
+		xxljob.WithClientTimeout(time.Millisecond*100),
+		xxljob.WithCallbackSpool(t.TempDir()),
+		xxljob.WithCallbackInterval("10ms"),
+		xxljob.WithHealthRegisterTimeout(time.Millisecond*200),
+		xxljob.WithHealthMaxCallbackBacklog(1),
+	)
+	defer e.Stop()
+
+	// It is healthy but not ready before the first registration.
+	should.Equal(xxljob.HealthOK, e.Health().Status)
+	status := e.Readiness()
+	should.Equal(xxljob.HealthUnavailable, status.Status)
+	should.Contains(status.Reasons, "executor is not registered yet")
+
+	// The undelivered callbacks are counted in the backlog.
+	e.AddJobHandler("demo", func(ctx context.Context, param xxljob.JobParam) error { return nil })
+	for i := 1; i <= 2; i++ {
+		should.NoError(e.TriggerJob(xxljob.RunParam{
+			JobID:           i,
+			ExecutorHandler: "demo",
+			LogID:           int64(i),
+			LogDateTime:     time.Now().UnixNano() / int64(time.Millisecond),
+		}))
+	}
+	should.Eventually(func() bool {
+		return e.Readiness().CallbackBacklog == 2
+	}, time.Second, time.Millisecond*10)
+	should.Contains(e.Readiness().Reasons, "too many callbacks waiting: 2")
+
+	// The liveness does not depend on the registration.
+	time.Sleep(time.Millisecond * 300)
+	should.Equal(xxljob.HealthOK, e.Health().Status)
+}
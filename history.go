@@ -0,0 +1,345 @@
+package xxljob
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const historyFileExt = ".json"
+
+// Execution is a finished job execution kept in the history.
+type Execution struct {
+	JobID       int           `json:"jobId"`
+	LogID       int64         `json:"logId"`
+	LogDateTime int64         `json:"logDateTime"` // trigger timestamp in milliseconds
+	Handler     string        `json:"handler"`
+	Params      string        `json:"params"`  // redacted by ParamsRedactor
+	Outcome     string        `json:"outcome"` // success, failure, timeout, killed, cover_early, shutdown or cancelled
+	HandleCode  int           `json:"handleCode"`
+	Error       string        `json:"error,omitempty"`
+	StartTime   time.Time     `json:"startTime"` // zero if the job has never been run
+	EndTime     time.Time     `json:"endTime"`
+	Duration    time.Duration `json:"duration"`
+	LogPath     string        `json:"logPath,omitempty"` // path of the job log file, empty if there is no log
+	Local       bool          `json:"local,omitempty"`   // whether the job is run by RunNow
+}
+
+// HistoryFilter selects the executions returned by History. The zero value selects all.
+type HistoryFilter struct {
+	Handler string    // only the executions of the handler
+	JobID   int       // only the executions of the job id
+	Outcome string    // only the executions with the outcome, e.g. failure
+	Since   time.Time // only the executions finished at or after it
+	Limit   int       // max number of executions to return, 0 means no limit
+}
+
+// match checks if the execution is selected by the filter.
+func (f HistoryFilter) match(x Execution) bool {
+	return (f.Handler == "" || f.Handler == x.Handler) &&
+		(f.JobID == 0 || f.JobID == x.JobID) &&
+		(f.Outcome == "" || f.Outcome == x.Outcome) &&
+		(f.Since.IsZero() || !x.EndTime.Before(f.Since))
+}
+
+// executionRing keeps the last executions of a handler, the oldest one is overwritten when it is full.
+type executionRing struct {
+	entries []Execution
+	next    int // where to put the next execution once the ring is full
+}
+
+// add puts the execution into the ring.
+func (r *executionRing) add(x Execution) {
+	if len(r.entries) < cap(r.entries) {
+		r.entries = append(r.entries, x)
+		return
+	}
+
+	r.entries[r.next] = x
+	r.next = (r.next + 1) % len(r.entries)
+}
+
+// list returns the executions from the oldest to the newest.
+func (r *executionRing) list() []Execution {
+	return append(append([]Execution(nil), r.entries[r.next:]...), r.entries[:r.next]...)
+}
+
+// history keeps the last executions of each handler in memory,
+// and persists them in dir if it is not empty, each handler has its own file.
+type history struct {
+	size int
+	dir  string
+
+	mu    sync.Mutex
+	rings map[string]*executionRing
+	dirty map[string]bool // handlers whose executions are not persisted yet
+
+	notify  chan struct{} // wakes up the persisting goroutine
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// newHistory creates a history which keeps size executions per handler,
+// and loads the persisted executions if dir is not empty.
+func newHistory(size int, dir string) (*history, error) {
+	h := &history{
+		size:    size,
+		dir:     dir,
+		rings:   make(map[string]*executionRing),
+		dirty:   make(map[string]bool),
+		notify:  make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	if dir == "" {
+		return h, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// load reads the persisted executions of all the handlers.
+func (h *history) load() error {
+	entries, err := os.ReadDir(h.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, historyFileExt) {
+			continue
+		}
+
+		b, err := os.ReadFile(filepath.Join(h.dir, name))
+		if err != nil {
+			return err
+		}
+
+		var executions []Execution
+		if err := json.Unmarshal(b, &executions); err != nil {
+			// A broken file only loses the history of one handler.
+			continue
+		}
+
+		for _, x := range executions {
+			h.ring(x.Handler).add(x)
+		}
+	}
+
+	return nil
+}
+
+// ring returns the ring of the handler, it is created if not exists.
+// The caller must hold h.mu unless the history is being loaded.
+func (h *history) ring(handler string) *executionRing {
+	r, ok := h.rings[handler]
+	if !ok {
+		r = &executionRing{entries: make([]Execution, 0, h.size)}
+		h.rings[handler] = r
+	}
+
+	return r
+}
+
+// add records the execution. The history of its handler is persisted asynchronously,
+// so that a slow disk does not delay the callbacks.
+func (h *history) add(x Execution) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	h.ring(x.Handler).add(x)
+	if h.dir != "" {
+		h.dirty[x.Handler] = true
+	}
+	h.mu.Unlock()
+
+	if h.dir != "" {
+		select {
+		case h.notify <- struct{}{}:
+		default: // the persisting goroutine is already notified
+		}
+	}
+}
+
+// persistLoop persists the history whenever it is updated, until close is called.
+func (h *history) persistLoop(onError func(err error)) {
+	defer close(h.stopped)
+
+	for {
+		select {
+		case <-h.notify:
+			if err := h.persist(); err != nil {
+				onError(err)
+			}
+		case <-h.stop:
+			if err := h.persist(); err != nil {
+				onError(err)
+			}
+			return
+		}
+	}
+}
+
+// persist writes the executions of the handlers updated since last time, each handler into its own file.
+func (h *history) persist() error {
+	h.mu.Lock()
+	updated := make(map[string][]Execution, len(h.dirty))
+	for handler := range h.dirty {
+		updated[handler] = h.rings[handler].list()
+	}
+	h.dirty = make(map[string]bool)
+	h.mu.Unlock()
+
+	var lastErr error
+	for handler, executions := range updated {
+		b, err := json.Marshal(executions)
+		if err == nil {
+			err = writeFileAtomic(filepath.Join(h.dir, url.PathEscape(handler)+historyFileExt), b, 0644)
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", handler, err)
+		}
+	}
+
+	return lastErr
+}
+
+// close persists the pending executions and stops the persisting goroutine.
+func (h *history) close() {
+	if h == nil || h.dir == "" {
+		return
+	}
+
+	close(h.stop)
+	<-h.stopped
+}
+
+// query returns the executions selected by the filter, the newest first.
+func (h *history) query(filter HistoryFilter) []Execution {
+	if h == nil {
+		return nil
+	}
+
+	h.mu.Lock()
+	var executions []Execution
+	for handler, r := range h.rings {
+		if filter.Handler != "" && filter.Handler != handler {
+			continue
+		}
+		for _, x := range r.list() {
+			if filter.match(x) {
+				executions = append(executions, x)
+			}
+		}
+	}
+	h.mu.Unlock()
+
+	sort.SliceStable(executions, func(i, j int) bool {
+		return executions[i].EndTime.After(executions[j].EndTime)
+	})
+
+	if filter.Limit > 0 && len(executions) > filter.Limit {
+		executions = executions[:filter.Limit]
+	}
+
+	return executions
+}
+
+// setupHistory creates the execution history, the executions persisted by last run will be loaded.
+// If the history cannot be persisted, the executions are kept in memory only.
+func (e *Executor) setupHistory() {
+	h, err := newHistory(e.HistorySize, e.HistoryDir)
+	if err != nil {
+		e.Logger.Error(logPrefix+"load execution history failed, keep it in memory: %v", err)
+		h, _ = newHistory(e.HistorySize, "")
+	}
+
+	if h.dir != "" {
+		go h.persistLoop(func(err error) {
+			e.Logger.Error(logPrefix+"persist execution history failed: %v", err)
+		})
+	}
+	e.history = h
+}
+
+// History returns the recent executions selected by the filter, the newest first.
+// At most HistorySize executions are kept for each handler.
+func (e *Executor) History(filter HistoryFilter) []Execution {
+	return e.history.query(filter)
+}
+
+// recordExecution adds the finished job into the history.
+func (e *Executor) recordExecution(job *Job, err error, handleCode int, handleMsg string) {
+	if e.history == nil {
+		return
+	}
+
+	x := Execution{
+		JobID:       job.ID,
+		LogID:       job.LogID,
+		LogDateTime: job.LogDateTime,
+		Handler:     job.Name,
+		Params:      e.redactParams(job.Param.Params),
+		Outcome:     jobOutcome(job, err),
+		HandleCode:  handleCode,
+		StartTime:   job.StartTime,
+		EndTime:     job.EndTime,
+		Duration:    job.Duration(),
+		Local:       job.local,
+	}
+	if err != nil {
+		x.Error = handleMsg
+	}
+	if !job.StartTime.IsZero() {
+		x.LogPath = job.logFile()
+	}
+
+	e.history.add(x)
+}
+
+// serveHistory is for querying the execution history.
+func (e *Executor) serveHistory(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+
+	var param HistoryParam
+	if r.ContentLength != 0 {
+		if err := e.parseParam(r, &param); err != nil {
+			fmt.Fprintln(w, NewErrorResponse(err.Error()).String())
+			return
+		}
+	}
+
+	filter := HistoryFilter{
+		Handler: param.Handler,
+		JobID:   param.JobID,
+		Outcome: param.Outcome,
+		Limit:   param.Limit,
+	}
+	if param.Since > 0 {
+		filter.Since = time.Unix(0, param.Since*int64(time.Millisecond))
+	}
+
+	res := NewSuccResponse()
+	res.Content = e.History(filter)
+
+	fmt.Fprintln(w, res.String())
+}
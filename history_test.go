@@ -0,0 +1,161 @@
+package xxljob_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	resty "github.com/go-resty/resty/v2"
+	"github.com/hyperjiang/xxljob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	should := require.New(t)
+
+	admin, _ := newFakeAdmin()
+	defer admin.Close()
+
+	logDir := t.TempDir()
+	historyDir := t.TempDir()
+	newExecutor := func() *xxljob.Executor {
+		e := xxljob.NewExecutor(
+			xxljob.WithHost(admin.URL),
+			xxljob.WithLogger(xxljob.DummyLogger()),
+			xxljob.WithLogDir(logDir),
+			xxljob.WithCallbackInterval("10ms"),
+			xxljob.WithHistorySize(3),
+			xxljob.WithHistoryDir(historyDir),
+		)
+		e.AddJobHandler("echo", func(ctx context.Context, param xxljob.JobParam) error {
+			if param.Params == "fail" {
+				return errors.New("failed")
+			}
+			return nil
+		})
+		e.AddJobHandler("other", func(ctx context.Context, param xxljob.JobParam) error {
+			return nil
+		})
+		return e
+	}
+
+	e := newExecutor()
+	should.Empty(e.History(xxljob.HistoryFilter{}))
+
+	for i := 1; i <= 4; i++ {
+		_, _ = e.RunNow(context.Background(), "echo", xxljob.JobParam{JobID: 1, Params: "password=abc"})
+	}
+	_, err := e.RunNow(context.Background(), "echo", xxljob.JobParam{JobID: 2, Params: "fail"})
+	should.EqualError(err, "failed")
+	since := time.Now()
+	_, err = e.RunNow(context.Background(), "other", xxljob.JobParam{JobID: 3})
+	should.NoError(err)
+
+	// Only the last 3 executions of each handler are kept, the newest first.
+	executions := e.History(xxljob.HistoryFilter{Handler: "echo"})
+	should.Len(executions, 3)
+	failed := executions[0]
+	should.Equal(2, failed.JobID)
+	should.Equal("failure", failed.Outcome)
+	should.Equal(500, failed.HandleCode)
+	should.Equal("failed", failed.Error)
+	should.True(failed.Local)
+	should.FileExists(failed.LogPath)
+	should.False(failed.EndTime.Before(failed.StartTime))
+
+	succeeded := executions[1]
+	should.Equal(1, succeeded.JobID)
+	should.Equal("success", succeeded.Outcome)
+	should.Equal("password=***", succeeded.Params)
+	should.Empty(succeeded.Error)
+
+	should.Len(e.History(xxljob.HistoryFilter{}), 4)
+	should.Len(e.History(xxljob.HistoryFilter{JobID: 1}), 2)
+	should.Len(e.History(xxljob.HistoryFilter{Outcome: "failure"}), 1)
+	should.Len(e.History(xxljob.HistoryFilter{Limit: 2}), 2)
+	executions = e.History(xxljob.HistoryFilter{Since: since})
+	should.Len(executions, 1)
+	should.Equal("other", executions[0].Handler)
+
+	// The jobs which are never run are recorded too.
+	release := make(chan struct{})
+	e.AddJobHandler("block", func(ctx context.Context, param xxljob.JobParam) error {
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	should.NoError(e.TriggerJob(xxljob.RunParam{JobID: 4, ExecutorHandler: "block", LogID: 1}))
+	should.NoError(e.TriggerJob(xxljob.RunParam{JobID: 4, ExecutorHandler: "block", LogID: 2}))
+	should.True(e.CancelQueuedJob(4, 2))
+	close(release)
+	should.Eventually(func() bool {
+		return len(e.History(xxljob.HistoryFilter{JobID: 4})) == 2
+	}, time.Second, time.Millisecond*10)
+	cancelled := e.History(xxljob.HistoryFilter{JobID: 4, Outcome: "cancelled"})
+	should.Len(cancelled, 1)
+	should.Equal(int64(2), cancelled[0].LogID)
+	should.True(cancelled[0].StartTime.IsZero())
+	should.Empty(cancelled[0].LogPath)
+
+	srv := httptest.NewServer(e.Handler())
+	defer srv.Close()
+	cli := resty.New().SetBaseURL(srv.URL).SetHeader("XXL-JOB-ACCESS-TOKEN", accessToken)
+	query := func(body interface{}) []xxljob.Execution {
+		req := cli.R()
+		if body != nil {
+			req.SetBody(body)
+		}
+		resp, err := req.Post("/history")
+		should.NoError(err)
+		var res struct {
+			Code    int                `json:"code"`
+			Content []xxljob.Execution `json:"content"`
+		}
+		should.NoError(json.Unmarshal(resp.Body(), &res))
+		should.Equal(200, res.Code)
+		return res.Content
+	}
+
+	should.Len(query(nil), 6)
+	executions = query(xxljob.HistoryParam{Handler: "echo", Outcome: "failure"})
+	should.Len(executions, 1)
+	should.Equal("failed", executions[0].Error)
+	should.Len(query(xxljob.HistoryParam{Since: since.UnixNano() / int64(time.Millisecond), Limit: 1}), 1)
+
+	should.NoError(e.Stop())
+
+	// The history is loaded after restart.
+	e2 := newExecutor()
+	defer e2.Stop()
+	should.Len(e2.History(xxljob.HistoryFilter{}), 6)
+	should.Equal("failed", e2.History(xxljob.HistoryFilter{Handler: "echo"})[0].Error)
+}
+
+func TestHistoryDisabled(t *testing.T) {
+	should := require.New(t)
+
+	admin, _ := newFakeAdmin()
+	defer admin.Close()
+
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(t.TempDir()),
+		xxljob.WithHistorySize(0),
+	)
+	defer e.Stop()
+
+	e.AddJobHandler("echo", func(ctx context.Context, param xxljob.JobParam) error {
+		return nil
+	})
+
+	_, err := e.RunNow(context.Background(), "echo", xxljob.JobParam{})
+	should.NoError(err)
+	should.Empty(e.History(xxljob.HistoryFilter{}))
+}
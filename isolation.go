@@ -0,0 +1,288 @@
+package xxljob
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	isolatedHandlerEnv     = "XXL_JOB_ISOLATED_HANDLER"
+	isolatedMemoryLimitEnv = "XXL_JOB_ISOLATED_MEMORY_LIMIT"
+	isolatedCPULimitEnv    = "XXL_JOB_ISOLATED_CPU_LIMIT"
+
+	// the line printed by the child process to report the result
+	isolatedResultPrefix = "\x00xxljob-result:"
+
+	// how long the child process waits for the cancel cause after SIGTERM
+	isolatedCauseWait = time.Millisecond * 100
+)
+
+// isolatedResult is the execution result reported by the child process.
+type isolatedResult struct {
+	Error      string        `json:"error,omitempty"`
+	Retryable  bool          `json:"retryable,omitempty"`  // the error is marked by Retryable
+	RetryAfter time.Duration `json:"retryAfter,omitempty"` // the delay asked by RetryableAfter
+}
+
+// isIsolatedChild checks if the current process is a child process running an isolated handler.
+func isIsolatedChild() bool {
+	return os.Getenv(isolatedHandlerEnv) != ""
+}
+
+// isIsolated checks if the handler should be run in a child process.
+func (e *Executor) isIsolated(name string) bool {
+	for _, h := range e.IsolatedHandlers {
+		if h == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isolatedHandler returns a handler which re-executes the current binary to run the named handler in a child process.
+// The params are sent to the child through stdin, and its output is written into the job log.
+// If the job is cancelled, the child is asked to exit by SIGTERM and killed by SIGKILL after IsolationKillGrace.
+func (e *Executor) isolatedHandler(name string) JobHandler {
+	return func(ctx context.Context, param JobParam) error {
+		logger := LoggerFromContext(ctx)
+
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+
+		cmd := exec.Command(exe, os.Args[1:]...)
+		cmd.Env = append(os.Environ(),
+			isolatedHandlerEnv+"="+name,
+			isolatedCPULimitEnv+"="+strconv.Itoa(e.IsolationCPULimit),
+		)
+		setProcessGroup(cmd)
+
+		// The memory limit is enforced by the cgroup only if the child starts in it,
+		// otherwise the child limits itself by rlimit before running the handler.
+		var cgroup string
+		inCgroup := false
+		if e.IsolationCgroup != "" {
+			name := fmt.Sprintf("xxljob-%d-%d", param.JobID, param.LogID)
+			dir, cleanup, err := createCgroup(e.IsolationCgroup, name, e.IsolationMemoryLimit)
+			if err != nil {
+				logger.Error("create cgroup failed, limit the memory by rlimit: %v", err)
+			} else {
+				defer cleanup()
+				cgroup = dir
+
+				closeCgroup, ok, err := startInCgroup(cmd, dir)
+				if err != nil {
+					logger.Error("open cgroup failed, limit the memory by rlimit: %v", err)
+				} else if ok {
+					defer closeCgroup()
+					inCgroup = true
+				}
+			}
+		}
+		if !inCgroup {
+			cmd.Env = append(cmd.Env, isolatedMemoryLimitEnv+"="+strconv.FormatInt(e.IsolationMemoryLimit, 10))
+		}
+
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		stderr, err := cmd.StderrPipe()
+		if err != nil {
+			return err
+		}
+
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		logger.Info("isolated process started: pid=%d", cmd.Process.Pid)
+
+		if cgroup != "" && !inCgroup {
+			if err := joinCgroup(cgroup, cmd.Process.Pid); err != nil {
+				logger.Error("join cgroup failed, the memory is limited by rlimit: %v", err)
+			}
+		}
+
+		if err := json.NewEncoder(stdin).Encode(param); err != nil {
+			_ = killProcessGroup(cmd)
+		}
+
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-ctx.Done():
+				// Tell the child why it is cancelled, then terminate it gracefully.
+				fmt.Fprintln(stdin, CancelCauseFromContext(ctx))
+				if err := terminateProcessGroup(cmd); err != nil {
+					logger.Error("terminate isolated process failed: %v", err)
+				}
+
+				select {
+				case <-done:
+				case <-time.After(e.IsolationKillGrace):
+					logger.Error("isolated process does not exit in %s, kill it", e.IsolationKillGrace)
+					_ = killProcessGroup(cmd)
+				}
+			case <-done:
+			}
+		}()
+
+		var result *isolatedResult
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go pipeLines(&wg, stdout, func(line string) {
+			if strings.HasPrefix(line, isolatedResultPrefix) {
+				result = new(isolatedResult)
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, isolatedResultPrefix)), result); err != nil {
+					result.Error = "invalid result of isolated process: " + err.Error()
+				}
+				return
+			}
+			logger.Info("%s", line)
+		})
+		go pipeLines(&wg, stderr, func(line string) { logger.Error("%s", line) })
+		wg.Wait()
+
+		err = cmd.Wait()
+		_ = stdin.Close()
+
+		if result != nil {
+			if result.Error == "" {
+				return nil
+			}
+			if result.Retryable {
+				// Let the executor retry policy retry it, which starts a new child process.
+				return RetryableAfter(errors.New(result.Error), result.RetryAfter)
+			}
+			return errors.New(result.Error)
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return fmt.Errorf("isolated process exits without result: %v", err)
+	}
+}
+
+// RunIsolated runs the isolated handler and exits, if the current process is a child process
+// started by the executor to run an isolated handler, otherwise it does nothing.
+// Start calls it automatically. If the executor is served by Handler instead of Start,
+// it should be called after all the job handlers are registered.
+func (e *Executor) RunIsolated() {
+	name := os.Getenv(isolatedHandlerEnv)
+	if name == "" {
+		return
+	}
+
+	os.Exit(e.runIsolated(name))
+}
+
+// runIsolated runs the handler in the child process and reports the result through stdout.
+func (e *Executor) runIsolated(name string) int {
+	memory, _ := strconv.ParseInt(os.Getenv(isolatedMemoryLimitEnv), 10, 64)
+	cpu, _ := strconv.Atoi(os.Getenv(isolatedCPULimitEnv))
+	if err := setResourceLimits(memory, cpu); err != nil {
+		fmt.Fprintf(os.Stderr, "set resource limits failed: %v\n", err)
+	}
+
+	report := func(err error) int {
+		var res isolatedResult
+		if err != nil {
+			res.Error = err.Error()
+			res.Retryable = IsRetryable(err)
+			res.RetryAfter = retryAfter(err)
+		}
+		b, _ := json.Marshal(res)
+		fmt.Fprintf(os.Stdout, "%s%s\n", isolatedResultPrefix, b)
+		return 0
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+	line, err := stdin.ReadBytes('\n')
+	if err != nil {
+		return report(fmt.Errorf("read params failed: %v", err))
+	}
+
+	var param JobParam
+	if err := json.Unmarshal(line, &param); err != nil {
+		return report(fmt.Errorf("invalid params: %v", err))
+	}
+
+	handler := e.GetJobHandler(name)
+	if handler == nil {
+		return report(errors.New("job handler not found"))
+	}
+
+	// The timeout is enforced by the parent process.
+	job := &Job{
+		ID:           param.JobID,
+		LogID:        param.LogID,
+		LogDateTime:  param.LogDateTime,
+		Name:         name,
+		Handle:       handler,
+		Param:        param,
+		FatalOnPanic: e.FatalOnPanic,
+		done:         make(chan error, 1),
+	}
+	job.ctx, job.cancel = context.WithCancel(ContextWithLogger(context.Background(), streamLogger{}))
+
+	// The parent sends the cancel cause before SIGTERM.
+	causeChan := make(chan CancelCause, 1)
+	go func() {
+		if cause, err := stdin.ReadString('\n'); err == nil {
+			causeChan <- CancelCause(strings.TrimSpace(cause))
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM)
+	go func() {
+		select {
+		case cause := <-causeChan:
+			job.stop(cause)
+		case <-sigChan:
+			// The signal may arrive before the cause is read.
+			select {
+			case cause := <-causeChan:
+				job.stop(cause)
+			case <-time.After(isolatedCauseWait):
+				job.stop(CauseCancelled)
+			}
+		}
+	}()
+
+	go job.Run()
+
+	return report(<-job.done)
+}
+
+// streamLogger writes the logs of the isolated handler to stdout and stderr,
+// which are collected into the job log by the parent process.
+type streamLogger struct{}
+
+func (l streamLogger) Info(format string, v ...interface{}) {
+	fmt.Fprintf(os.Stdout, format+"\n", v...)
+}
+
+func (l streamLogger) Error(format string, v ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", v...)
+}
@@ -0,0 +1,163 @@
+package xxljob_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperjiang/xxljob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// The test binary is re-executed to run the isolated handlers.
+	if os.Getenv("XXL_JOB_ISOLATED_HANDLER") != "" {
+		newIsolationExecutor().RunIsolated()
+	}
+
+	os.Exit(m.Run())
+}
+
+// newIsolationExecutor creates an executor with the handlers used by TestIsolation.
+func newIsolationExecutor(opts ...xxljob.Option) *xxljob.Executor {
+	opts = append([]xxljob.Option{
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithIsolatedHandlers("isolated_echo", "isolated_fail", "isolated_hang", "isolated_crash", "isolated_cancel", "isolated_long", "isolated_flaky"),
+		xxljob.WithIsolationKillGrace(time.Millisecond * 200),
+	}, opts...)
+	e := xxljob.NewExecutor(opts...)
+
+	e.AddJobHandler("isolated_echo", func(ctx context.Context, param xxljob.JobParam) error {
+		xxljob.LoggerFromContext(ctx).Info("echo: %s pid=%d", param.Params, os.Getpid())
+		return nil
+	})
+	e.AddJobHandler("isolated_fail", func(ctx context.Context, param xxljob.JobParam) error {
+		return errors.New("isolated failure")
+	})
+	e.AddJobHandler("isolated_hang", func(ctx context.Context, param xxljob.JobParam) error {
+		// Ignore the context, so that the process has to be killed.
+		select {}
+	})
+	e.AddJobHandler("isolated_crash", func(ctx context.Context, param xxljob.JobParam) error {
+		os.Exit(3)
+		return nil
+	})
+	e.AddJobHandler("isolated_long", func(ctx context.Context, param xxljob.JobParam) error {
+		// A log line longer than the default buffer of bufio.Scanner.
+		xxljob.LoggerFromContext(ctx).Info("%s", strings.Repeat("x", 100*1024))
+		return nil
+	})
+	e.AddJobHandler("isolated_flaky", func(ctx context.Context, param xxljob.JobParam) error {
+		// Each attempt runs in a new child process, so the attempts are counted in a file.
+		b, _ := os.ReadFile(param.Params)
+		if len(b) == 0 {
+			_ = os.WriteFile(param.Params, []byte("1"), 0644)
+			return xxljob.Retryable(errors.New("transient"))
+		}
+		return nil
+	})
+	e.AddJobHandler("isolated_cancel", func(ctx context.Context, param xxljob.JobParam) error {
+		<-ctx.Done()
+		xxljob.LoggerFromContext(ctx).Info("cause: %s", xxljob.CancelCauseFromContext(ctx))
+		return ctx.Err()
+	})
+
+	return e
+}
+
+func TestIsolation(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	logDir := t.TempDir()
+	e := newIsolationExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogDir(logDir),
+		xxljob.WithCallbackInterval("10ms"),
+	)
+	defer e.Stop()
+
+	now := time.Now()
+	run := func(jobID int, logID int64, handler string, timeout int) xxljob.CallbackParam {
+		should.NoError(e.TriggerJob(xxljob.RunParam{
+			JobID:           jobID,
+			ExecutorHandler: handler,
+			ExecutorParams:  "hello",
+			ExecutorTimeout: timeout,
+			LogID:           logID,
+			LogDateTime:     now.UnixNano() / int64(time.Millisecond),
+		}))
+		return <-callbacks
+	}
+	readLog := func(logID int64) string {
+		b, err := os.ReadFile(filepath.Join(logDir, now.Format("2006-01-02"), fmt.Sprintf("%d.log", logID)))
+		should.NoError(err)
+		return string(b)
+	}
+
+	cb := run(1, 1, "isolated_echo", 0)
+	should.Equal(200, cb.HandleCode)
+	log := readLog(1)
+	should.Contains(log, "[INFO] echo: hello")
+	should.NotContains(log, fmt.Sprintf("pid=%d\n", os.Getpid()))
+
+	// The result is not lost after a long log line.
+	cb = run(6, 6, "isolated_long", 0)
+	should.Equal(200, cb.HandleCode, cb.HandleMsg)
+	should.Contains(readLog(6), strings.Repeat("x", 100*1024))
+
+	cb = run(2, 2, "isolated_fail", 0)
+	should.Equal(500, cb.HandleCode)
+	should.Equal("isolated failure", cb.HandleMsg)
+
+	cb = run(3, 3, "isolated_crash", 0)
+	should.Equal(500, cb.HandleCode)
+	should.Contains(cb.HandleMsg, "isolated process exits without result")
+
+	// The handler ignores the context, so it is killed after the grace period.
+	start := time.Now()
+	cb = run(4, 4, "isolated_hang", 1)
+	should.Equal(502, cb.HandleCode)
+	should.Less(time.Since(start), time.Second*5)
+	should.Contains(readLog(4), "kill it")
+
+	// The cancel cause is passed to the child process.
+	cb = run(5, 5, "isolated_cancel", 1)
+	should.Equal(502, cb.HandleCode)
+	should.Contains(readLog(5), "[INFO] cause: TIMEOUT")
+}
+
+func TestIsolationRetryable(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	e := newIsolationExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogDir(t.TempDir()),
+		xxljob.WithCallbackInterval("10ms"),
+		xxljob.WithDefaultRetryPolicy(xxljob.RetryPolicy{MaxAttempts: 2, InitialDelay: time.Millisecond}),
+		// The cgroup cannot be created, so the memory is limited by rlimit instead.
+		xxljob.WithIsolationCgroup(filepath.Join(t.TempDir(), "missing", "parent")),
+	)
+	defer e.Stop()
+
+	// The retryable error of the child process is retried by the executor.
+	should.NoError(e.TriggerJob(xxljob.RunParam{
+		JobID:           1,
+		ExecutorHandler: "isolated_flaky",
+		ExecutorParams:  filepath.Join(t.TempDir(), "attempts"),
+		LogID:           1,
+		LogDateTime:     time.Now().UnixNano() / int64(time.Millisecond),
+	}))
+	cb := <-callbacks
+	should.Equal(200, cb.HandleCode, cb.HandleMsg)
+}
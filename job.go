@@ -2,9 +2,12 @@ package xxljob
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime/debug"
+	"sync"
 	"time"
 )
 
@@ -20,6 +23,53 @@ const (
 	CoverEarly = "COVER_EARLY"
 )
 
+// CancelCause is the reason why a job is cancelled.
+type CancelCause string
+
+const (
+	// CauseNone: the job is not cancelled.
+	CauseNone CancelCause = ""
+	// CauseKilled: the job is killed by xxl-job server.
+	CauseKilled CancelCause = "KILLED"
+	// CauseCoverEarly: the job is replaced by a new one with the COVER_EARLY block strategy.
+	CauseCoverEarly CancelCause = "COVER_EARLY"
+	// CauseShutdown: the executor is shutting down.
+	CauseShutdown CancelCause = "SHUTDOWN"
+	// CauseTimeout: the job exceeds the execution timeout.
+	CauseTimeout CancelCause = "TIMEOUT"
+	// CauseCancelled: the job is cancelled by Job.Stop or removed from the queue.
+	CauseCancelled CancelCause = "CANCELLED"
+)
+
+var causeMessages = map[CancelCause]string{
+	CauseKilled:     "job killed by xxl-job server",
+	CauseCoverEarly: "job killed by block strategy " + CoverEarly,
+	CauseShutdown:   "job killed by executor shutdown",
+	CauseTimeout:    "job execution timeout",
+	CauseCancelled:  "job cancelled",
+}
+
+// message returns the human readable message of the cause.
+func (c CancelCause) message() string {
+	return causeMessages[c]
+}
+
+const jobKey contextKey = "xxljob_job"
+
+// CancelCauseFromContext returns why the job of the given handler context is cancelled.
+// It returns CauseNone if the context is not done or is not cancelled by the executor.
+func CancelCauseFromContext(ctx context.Context) CancelCause {
+	if ctx.Err() == nil {
+		return CauseNone
+	}
+
+	if job, ok := ctx.Value(jobKey).(*Job); ok {
+		return job.cancelCause()
+	}
+
+	return CauseNone
+}
+
 // Job represents a scheduled job.
 type Job struct {
 	ID          int
@@ -32,10 +82,25 @@ type Job struct {
 	StartTime   time.Time
 	EndTime     time.Time
 	LogDir      string
+	// If true, a panic in the handler crashes the process instead of being recovered.
+	FatalOnPanic bool
+	// Tracer traces the job execution, nil means no tracing.
+	Tracer Tracer
 
 	ctx    context.Context
 	cancel context.CancelFunc
 	done   chan error
+	mu     sync.Mutex
+	cause  CancelCause // why the job is stopped by the executor
+
+	// concurrency state, guarded by the mutex of the executor
+	maxConcurrency int       // max number of running jobs of the handler, 0 means no limit
+	slotted        bool      // whether the job holds a slot of the concurrency limits
+	startedAt      time.Time // when the job takes a slot and starts running
+
+	// result of the local job run by RunNow, which is not reported to xxl-job server
+	local  bool
+	result chan RunResult
 }
 
 // JobParam is the parameter passed to the job handler.
@@ -43,6 +108,15 @@ type JobParam struct {
 	Params        string
 	ShardingIndex int
 	ShardingTotal int
+
+	// trigger metadata
+	JobID         int
+	LogID         int64
+	LogDateTime   int64     // trigger timestamp in milliseconds
+	TriggerTime   time.Time // trigger time converted from LogDateTime
+	Handler       string
+	BlockStrategy string
+	Timeout       int // timeout in seconds, 0 means no timeout
 }
 
 // JobHandler is the handler function for executing job.
@@ -51,23 +125,22 @@ type JobHandler func(ctx context.Context, param JobParam) error
 // Run runs the job.
 func (j *Job) Run() {
 	if j.ctx == nil {
-		j.ctx = context.Background()
+		j.ctx, j.cancel = context.WithCancel(context.Background())
 	}
 
+	// The timeout is counted from the moment the job starts running, not when it is queued.
 	if j.Timeout > 0 {
-		j.ctx, j.cancel = context.WithTimeout(j.ctx, time.Duration(j.Timeout)*time.Second)
-	} else {
-		j.ctx, j.cancel = context.WithCancel(j.ctx)
+		var cancel context.CancelFunc
+		j.ctx, cancel = context.WithTimeout(j.ctx, time.Duration(j.Timeout)*time.Second)
+		defer cancel()
 	}
+	j.ctx = context.WithValue(j.ctx, jobKey, j)
 
 	var jobLogger *fileLogger
 
 	// Prepare log file if LogDir is configured.
-	if j.LogDir != "" {
-		logDate := time.Unix(j.LogDateTime/1000, 0)
-		logDir := filepath.Join(j.LogDir, logDate.Format("2006-01-02"))
-		if err := os.MkdirAll(logDir, 0755); err == nil {
-			logFile := filepath.Join(logDir, fmt.Sprintf("%d.log", j.LogID))
+	if logFile := j.logFile(); logFile != "" {
+		if err := os.MkdirAll(filepath.Dir(logFile), 0755); err == nil {
 			if f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err == nil {
 				logger := &fileLogger{file: f}
 				jobLogger = logger
@@ -82,7 +155,25 @@ func (j *Job) Run() {
 		jobLogger.Info("job start: id=%d logId=%d handler=%s params=%s", j.ID, j.LogID, j.Name, j.Param.Params)
 	}
 
-	err := j.Handle(j.ctx, j.Param)
+	var span Span = noopSpan{}
+	if j.Tracer != nil {
+		j.ctx, span = j.Tracer.Start(j.ctx, "xxljob.job "+j.Name, SpanKindInternal,
+			Attr("xxljob.handler", j.Name),
+			Attr("xxljob.job_id", j.ID),
+			Attr("xxljob.log_id", j.LogID),
+			Attr("xxljob.sharding_index", j.Param.ShardingIndex),
+			Attr("xxljob.sharding_total", j.Param.ShardingTotal),
+			Attr("xxljob.block_strategy", j.Param.BlockStrategy),
+		)
+	}
+
+	err := j.handle()
+
+	span.SetAttributes(Attr("xxljob.outcome", jobOutcome(j, err)))
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
 
 	if jobLogger != nil {
 		if err != nil {
@@ -95,12 +186,78 @@ func (j *Job) Run() {
 	j.done <- err
 }
 
+// logFile returns the path of the job log file, or empty if LogDir is not configured.
+func (j *Job) logFile() string {
+	if j.LogDir == "" {
+		return ""
+	}
+
+	logDate := time.Unix(j.LogDateTime/1000, 0)
+
+	return filepath.Join(j.LogDir, logDate.Format("2006-01-02"), fmt.Sprintf("%d.log", j.LogID))
+}
+
+// handle calls the job handler and converts a panic into an error.
+// The stack trace of the panic is written into the job log.
+func (j *Job) handle() (err error) {
+	defer func() {
+		if j.FatalOnPanic {
+			return
+		}
+
+		if r := recover(); r != nil {
+			err = panicError(j.ctx, r)
+		}
+	}()
+
+	return j.Handle(j.ctx, j.Param)
+}
+
+// panicError writes the stack trace of the recovered panic into the job log and converts it into an error.
+// It must be called by the deferred function which recovers the panic.
+func panicError(ctx context.Context, r interface{}) error {
+	LoggerFromContext(ctx).Error("job panic: %v\n%s", r, debug.Stack())
+
+	return fmt.Errorf("job handler panic: %v", r)
+}
+
 // Stop stops the job.
 func (j *Job) Stop() {
-	j.cancel()
+	j.stop(CauseCancelled)
+}
+
+// stop stops the job with the given cause, only the first cause is kept.
+func (j *Job) stop(cause CancelCause) {
+	j.mu.Lock()
+	if j.cause == CauseNone {
+		j.cause = cause
+	}
+	j.mu.Unlock()
+
+	if j.cancel != nil {
+		j.cancel()
+	}
+}
+
+// cancelCause returns why the job is cancelled.
+func (j *Job) cancelCause() CancelCause {
+	j.mu.Lock()
+	cause := j.cause
+	j.mu.Unlock()
+
+	if cause == CauseNone && j.ctx != nil && errors.Is(j.ctx.Err(), context.DeadlineExceeded) {
+		return CauseTimeout
+	}
+
+	return cause
 }
 
 // Duration returns the duration of job execution.
+// It returns 0 if the job has never been run.
 func (j *Job) Duration() time.Duration {
+	if j.StartTime.IsZero() {
+		return 0
+	}
+
 	return TruncateDuration(j.EndTime.Sub(j.StartTime))
 }
@@ -0,0 +1,179 @@
+package xxljob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RunResult is the result of a job run locally by RunNow.
+type RunResult struct {
+	LogID       int64         `json:"logId"`
+	LogDateTime int64         `json:"logDateTime"` // timestamp in milliseconds, locates the log file together with LogID
+	HandleCode  int           `json:"handleCode"`
+	HandleMsg   string        `json:"handleMsg"`
+	Duration    time.Duration `json:"duration"`
+}
+
+// RunNow runs the registered job handler on this executor without xxl-job server, and waits for the result.
+// The job goes through the same pipeline as a triggered one, including the job log, timeout and block strategy,
+// but it has a locally generated negative log id and its result is not reported to xxl-job server.
+// Only JobID, Params, ShardingIndex, ShardingTotal, BlockStrategy and Timeout of param are used,
+// the jobs of the same JobID are run according to the block strategy.
+// If ctx is done before the job finishes, the job is cancelled and ctx.Err() is returned without waiting for it.
+// The returned error is not nil if the job cannot be run or it fails.
+func (e *Executor) RunNow(ctx context.Context, name string, param JobParam) (RunResult, error) {
+	job, err := e.runLocal(name, param)
+	if err != nil {
+		return RunResult{}, err
+	}
+
+	select {
+	case res := <-job.result:
+		return res, res.err()
+	case <-ctx.Done():
+		// Do not wait for a handler which ignores the cancellation, its result is dropped into the buffered channel.
+		e.cancelJob(job)
+		res := RunResult{
+			LogID:       job.LogID,
+			LogDateTime: job.LogDateTime,
+			HandleCode:  failureCode,
+			HandleMsg:   CauseCancelled.message(),
+		}
+		return res, ctx.Err()
+	}
+}
+
+// err converts a failed result into an error.
+func (res RunResult) err() error {
+	if res.HandleCode == successCode {
+		return nil
+	}
+
+	return errors.New(res.HandleMsg)
+}
+
+// runLocal triggers a local job of the handler.
+func (e *Executor) runLocal(name string, param JobParam) (*Job, error) {
+	if e.GetJobHandler(name) == nil {
+		return nil, errors.New("job handler not found")
+	}
+
+	return e.triggerJob(RunParam{
+		JobID:                 param.JobID,
+		ExecutorHandler:       name,
+		ExecutorParams:        param.Params,
+		ExecutorBlockStrategy: param.BlockStrategy,
+		ExecutorTimeout:       param.Timeout,
+		LogDateTime:           time.Now().UnixNano() / int64(time.Millisecond),
+		GlueType:              GlueBean,
+		BroadcastIndex:        param.ShardingIndex,
+		BroadcastTotal:        param.ShardingTotal,
+	}, true)
+}
+
+// nextLocalLogID generates a negative log id for a local job, which never conflicts with the ones of xxl-job server.
+// The caller must hold e.mu.
+func (e *Executor) nextLocalLogID() int64 {
+	id := -time.Now().UnixNano()
+	if id >= e.lastLocalLogID {
+		id = e.lastLocalLogID - 1
+	}
+	e.lastLocalLogID = id
+
+	return id
+}
+
+// cancelJob cancels the running or pending job.
+func (e *Executor) cancelJob(job *Job) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	q, ok := e.queues[job.ID]
+	if !ok {
+		return
+	}
+
+	if q.running == job {
+		// The waiting job is removed from the queue when its result is handled.
+		if e.removeWaiting(job) {
+			e.discardJob(job, CauseCancelled)
+		} else {
+			job.stop(CauseCancelled)
+		}
+		return
+	}
+
+	if q.remove(job.LogID) != nil {
+		e.discardJob(job, CauseCancelled)
+	}
+}
+
+// runNow is for running a job handler locally, it waits for the result unless the request is async.
+func (e *Executor) runNow(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+
+	var param RunNowParam
+	if err := e.parseParam(r, &param); err != nil {
+		fmt.Fprintln(w, NewErrorResponse(err.Error()).String())
+		return
+	}
+
+	jobParam := JobParam{
+		JobID:         param.JobID,
+		Params:        param.Params,
+		ShardingIndex: param.ShardingIndex,
+		ShardingTotal: param.ShardingTotal,
+		BlockStrategy: param.BlockStrategy,
+		Timeout:       param.Timeout,
+	}
+
+	if param.Async {
+		job, err := e.runLocal(param.Handler, jobParam)
+		if err != nil {
+			fmt.Fprintln(w, NewErrorResponse(err.Error()).String())
+			return
+		}
+
+		res := NewSuccResponse()
+		res.Content = RunResult{LogID: job.LogID, LogDateTime: job.LogDateTime}
+		fmt.Fprintln(w, res.String())
+		return
+	}
+
+	if err := e.allowSyncRun(w, param.Handler, param.Timeout); err != nil {
+		fmt.Fprintln(w, NewErrorResponse(err.Error()).String())
+		return
+	}
+
+	result, err := e.RunNow(r.Context(), param.Handler, jobParam)
+	if err != nil && result.LogID == 0 {
+		fmt.Fprintln(w, NewErrorResponse(err.Error()).String())
+		return
+	}
+
+	fmt.Fprintln(w, Response{Code: result.HandleCode, Msg: result.HandleMsg, Content: result}.String())
+}
+
+// allowSyncRun makes sure the result of a sync run can be written after the job finishes,
+// by removing the write deadline of the response. If it cannot be removed, only the jobs which
+// time out within WriteTimeout are run in sync mode, the others should be run in async mode.
+func (e *Executor) allowSyncRun(w http.ResponseWriter, handler string, timeout int) error {
+	if clearWriteDeadline(w) == nil || e.WriteTimeout <= 0 {
+		return nil
+	}
+
+	// The timeout enforced by the handler options is applied.
+	params := RunParam{ExecutorTimeout: timeout}
+	if options, ok := e.GetHandlerOptions(handler); ok {
+		options.apply(&params)
+	}
+
+	if params.ExecutorTimeout <= 0 || time.Duration(params.ExecutorTimeout)*time.Second >= e.WriteTimeout {
+		return fmt.Errorf("the timeout of a sync run must be less than the write timeout %s, use async instead", e.WriteTimeout)
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package xxljob_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	resty "github.com/go-resty/resty/v2"
+	"github.com/hyperjiang/xxljob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunNow(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	logDir := t.TempDir()
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(logDir),
+		xxljob.WithCallbackInterval("10ms"),
+	)
+	defer e.Stop()
+
+	e.AddJobHandler("echo", func(ctx context.Context, param xxljob.JobParam) error {
+		xxljob.LoggerFromContext(ctx).Info("echo: %s %d/%d", param.Params, param.ShardingIndex, param.ShardingTotal)
+		if param.Params == "fail" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	e.AddJobHandler("hang", func(ctx context.Context, param xxljob.JobParam) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	res, err := e.RunNow(context.Background(), "echo", xxljob.JobParam{Params: "hello", ShardingIndex: 1, ShardingTotal: 2})
+	should.NoError(err)
+	should.Less(res.LogID, int64(0))
+	should.Equal(200, res.HandleCode)
+
+	logDate := time.Unix(0, res.LogDateTime*int64(time.Millisecond))
+	b, err := os.ReadFile(filepath.Join(logDir, logDate.Format("2006-01-02"), fmt.Sprintf("%d.log", res.LogID)))
+	should.NoError(err)
+	should.Contains(string(b), "echo: hello 1/2")
+
+	res2, err := e.RunNow(context.Background(), "echo", xxljob.JobParam{Params: "fail"})
+	should.EqualError(err, "failed")
+	should.Equal(500, res2.HandleCode)
+	should.NotEqual(res.LogID, res2.LogID)
+
+	// The timeout is applied.
+	res, err = e.RunNow(context.Background(), "hang", xxljob.JobParam{Timeout: 1})
+	should.Error(err)
+	should.Equal(502, res.HandleCode)
+
+	// The job is cancelled with the context.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	res, err = e.RunNow(ctx, "hang", xxljob.JobParam{})
+	should.ErrorIs(err, context.DeadlineExceeded)
+	should.Equal(500, res.HandleCode)
+	should.Equal("job cancelled", res.HandleMsg)
+
+	// It does not wait for a handler which ignores the cancellation.
+	release := make(chan struct{})
+	defer close(release)
+	e.AddJobHandler("stubborn", func(ctx context.Context, param xxljob.JobParam) error {
+		<-release
+		return nil
+	})
+	ctx2, cancel2 := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel2()
+	st := time.Now()
+	_, err = e.RunNow(ctx2, "stubborn", xxljob.JobParam{JobID: 1})
+	should.ErrorIs(err, context.DeadlineExceeded)
+	should.Less(int64(time.Since(st)), int64(time.Second))
+
+	_, err = e.RunNow(context.Background(), "unknown", xxljob.JobParam{})
+	should.EqualError(err, "job handler not found")
+
+	// No result is reported to xxl-job server.
+	time.Sleep(time.Millisecond * 50)
+	should.Empty(callbacks)
+}
+
+func TestRunNowEndpoint(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(t.TempDir()),
+		xxljob.WithCallbackInterval("10ms"),
+	)
+	defer e.Stop()
+
+	params := make(chan xxljob.JobParam, 1)
+	e.AddJobHandler("echo", func(ctx context.Context, param xxljob.JobParam) error {
+		params <- param
+		return nil
+	})
+
+	srv := httptest.NewServer(e.Handler())
+	defer srv.Close()
+
+	post := func(token string, body xxljob.RunNowParam) xxljob.Response {
+		resp, err := resty.New().R().
+			SetHeader("XXL-JOB-ACCESS-TOKEN", token).
+			SetBody(body).
+			Post(srv.URL + "/runNow")
+		should.NoError(err)
+		var res xxljob.Response
+		should.NoError(json.Unmarshal(resp.Body(), &res))
+		return res
+	}
+
+	res := post("wrong", xxljob.RunNowParam{Handler: "echo"})
+	should.Equal(500, res.Code)
+	should.Equal("the access token is wrong", res.Msg)
+
+	res = post(accessToken, xxljob.RunNowParam{JobID: 1, Handler: "echo", Params: "hello"})
+	should.Equal(200, res.Code)
+	content := res.Content.(map[string]interface{})
+	should.Less(content["logId"].(float64), float64(0))
+	param := <-params
+	should.Equal(1, param.JobID)
+	should.Equal("hello", param.Params)
+
+	res = post(accessToken, xxljob.RunNowParam{Handler: "echo", Async: true})
+	should.Equal(200, res.Code)
+	<-params
+
+	res = post(accessToken, xxljob.RunNowParam{Handler: "unknown"})
+	should.Equal(500, res.Code)
+	should.Equal("job handler not found", res.Msg)
+
+	time.Sleep(time.Millisecond * 50)
+	should.Empty(callbacks)
+}
+
+func TestRunNowEndpointWriteTimeout(t *testing.T) {
+	should := require.New(t)
+
+	e := xxljob.NewExecutor(
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(t.TempDir()),
+		xxljob.WithWriteTimeout(time.Millisecond*100),
+	)
+	defer e.Stop()
+
+	e.AddJobHandler("slow", func(ctx context.Context, param xxljob.JobParam) error {
+		time.Sleep(time.Millisecond * 300)
+		return nil
+	})
+
+	srv := httptest.NewUnstartedServer(e.Handler())
+	srv.Config.WriteTimeout = e.WriteTimeout
+	srv.Start()
+	defer srv.Close()
+
+	// The result of a sync run is written even if the job runs longer than the write timeout.
+	resp, err := resty.New().R().
+		SetHeader("XXL-JOB-ACCESS-TOKEN", accessToken).
+		SetBody(xxljob.RunNowParam{Handler: "slow"}).
+		Post(srv.URL + "/runNow")
+	should.NoError(err)
+	var res xxljob.Response
+	should.NoError(json.Unmarshal(resp.Body(), &res))
+	should.Equal(200, res.Code, res.Msg)
+}
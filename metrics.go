@@ -0,0 +1,272 @@
+package xxljob
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the histogram buckets in seconds of the job duration, jobs may run for hours.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 600, 1800, 3600}
+
+// requestBuckets are the histogram buckets in seconds of the requests to xxl-job server.
+var requestBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metrics collects the executor metrics and writes them in Prometheus text format,
+// so that users who do not enable them are not forced to depend on the Prometheus client.
+// All the methods are no-op on a nil *metrics.
+type metrics struct {
+	mu                sync.Mutex
+	jobRuns           *counterVec
+	jobDuration       *histogramVec
+	callbackFailures  *counterVec
+	registrations     *counterVec
+	adminRequestTimes *histogramVec
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		jobRuns:           newCounterVec("xxljob_job_runs_total", "Number of finished jobs by handler and outcome.", "handler", "outcome"),
+		jobDuration:       newHistogramVec("xxljob_job_duration_seconds", "Duration of the job execution.", durationBuckets, "handler"),
+		callbackFailures:  newCounterVec("xxljob_callback_failures_total", "Number of failed callback deliveries to xxl-job server."),
+		registrations:     newCounterVec("xxljob_registrations_total", "Number of registrations to xxl-job server by result.", "result"),
+		adminRequestTimes: newHistogramVec("xxljob_admin_request_duration_seconds", "Latency of the requests to xxl-job server.", requestBuckets, "endpoint"),
+	}
+}
+
+// observeJob records a finished job.
+func (m *metrics) observeJob(handler, outcome string, d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.jobRuns.add(1, handler, outcome)
+	m.jobDuration.observe(d.Seconds(), handler)
+}
+
+// callbackFailed records a failed callback delivery.
+func (m *metrics) callbackFailed() {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.callbackFailures.add(1)
+}
+
+// registered records the result of a registration.
+func (m *metrics) registered(err error) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err != nil {
+		m.registrations.add(1, "failure")
+	} else {
+		m.registrations.add(1, "success")
+	}
+}
+
+// observeRequest records the latency of a request to xxl-job server.
+func (m *metrics) observeRequest(endpoint string, d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.adminRequestTimes.observe(d.Seconds(), endpoint)
+}
+
+// write writes the collected metrics in Prometheus text format.
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.jobRuns.write(w)
+	m.jobDuration.write(w)
+	m.callbackFailures.write(w)
+	m.registrations.write(w)
+	m.adminRequestTimes.write(w)
+}
+
+// jobOutcome returns the outcome label of the job result.
+func jobOutcome(job *Job, err error) string {
+	if err == nil {
+		return "success"
+	}
+
+	if cause := job.cancelCause(); cause != CauseNone {
+		return strings.ToLower(string(cause))
+	}
+
+	return "failure"
+}
+
+// serveMetrics is for Prometheus to scrape the executor metrics.
+func (e *Executor) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	e.mu.Lock()
+	running := e.running
+	queued := len(e.waiting)
+	for _, q := range e.queues {
+		queued += len(q.pending)
+	}
+	e.mu.Unlock()
+
+	backlog := len(e.callbackChan)
+	if e.spool != nil {
+		backlog += e.spool.count()
+	}
+
+	writeGauge(w, "xxljob_jobs_running", "Number of running jobs.", float64(running))
+	writeGauge(w, "xxljob_jobs_queued", "Number of jobs waiting in the queues or for a slot.", float64(queued))
+	writeGauge(w, "xxljob_callback_queue_depth", "Number of callbacks waiting to be delivered to xxl-job server.", float64(backlog))
+	e.metrics.write(w)
+}
+
+// counterVec is a counter with labels.
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+	values map[string]float64 // key is the joined label values
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+func (c *counterVec) add(v float64, labelValues ...string) {
+	c.values[strings.Join(labelValues, "\xff")] += v
+}
+
+func (c *counterVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	if len(c.labels) == 0 && len(c.values) == 0 {
+		fmt.Fprintf(w, "%s 0\n", c.name)
+		return
+	}
+
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, key), formatValue(c.values[key]))
+	}
+}
+
+// histogramVec is a histogram with labels.
+type histogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	series  map[string]*histogram // key is the joined label values
+}
+
+type histogram struct {
+	counts []uint64 // counts of each bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogram)}
+}
+
+func (h *histogramVec) observe(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := h.series[key]
+		labels := append(append([]string{}, h.labels...), "le")
+
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(labels, key+"\xff"+formatValue(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(labels, key+"\xff+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, key), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, key), s.count)
+	}
+}
+
+// writeGauge writes a gauge without labels.
+func writeGauge(w io.Writer, name, help string, v float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name, formatValue(v))
+}
+
+// formatLabels formats the label pairs, the values are joined in key.
+func formatLabels(names []string, key string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	values := strings.Split(key, "\xff")
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + labelEscaper.Replace(values[i]) + `"`
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
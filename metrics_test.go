@@ -0,0 +1,88 @@
+package xxljob_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	resty "github.com/go-resty/resty/v2"
+	"github.com/hyperjiang/xxljob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(t.TempDir()),
+		xxljob.WithCallbackInterval("10ms"),
+		xxljob.WithRegisterInterval("10ms"),
+		xxljob.WithMetrics(true),
+	)
+	defer e.Stop()
+
+	e.AddJobHandler("demo", func(ctx context.Context, param xxljob.JobParam) error {
+		if param.Params == "fail" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	for i, params := range []string{"ok", "ok", "fail"} {
+		should.NoError(e.TriggerJob(xxljob.RunParam{
+			JobID:           1,
+			ExecutorHandler: "demo",
+			ExecutorParams:  params,
+			LogID:           int64(i + 1),
+			LogDateTime:     time.Now().UnixNano() / int64(time.Millisecond),
+		}))
+	}
+	for i := 0; i < 3; i++ {
+		<-callbacks
+	}
+
+	srv := httptest.NewServer(e.Handler())
+	defer srv.Close()
+
+	var body string
+	should.Eventually(func() bool {
+		// The metrics endpoint does not require the access token.
+		resp, err := resty.New().R().Get(srv.URL + "/metrics")
+		should.NoError(err)
+		should.Equal(http.StatusOK, resp.StatusCode())
+		should.Contains(resp.Header().Get("Content-Type"), "text/plain")
+		body = resp.String()
+		return strings.Contains(body, `xxljob_registrations_total{result="success"}`)
+	}, time.Second, time.Millisecond*10)
+
+	should.Contains(body, "# TYPE xxljob_job_runs_total counter\n")
+	should.Contains(body, `xxljob_job_runs_total{handler="demo",outcome="success"} 2`+"\n")
+	should.Contains(body, `xxljob_job_runs_total{handler="demo",outcome="failure"} 1`+"\n")
+	should.Contains(body, "# TYPE xxljob_job_duration_seconds histogram\n")
+	should.Contains(body, `xxljob_job_duration_seconds_bucket{handler="demo",le="+Inf"} 3`+"\n")
+	should.Contains(body, `xxljob_job_duration_seconds_count{handler="demo"} 3`+"\n")
+	should.Contains(body, "xxljob_jobs_running 0\n")
+	should.Contains(body, "xxljob_jobs_queued 0\n")
+	should.Contains(body, "# TYPE xxljob_callback_queue_depth gauge\n")
+	should.Contains(body, "xxljob_callback_failures_total 0\n")
+	should.Contains(body, `xxljob_registrations_total{result="success"}`)
+	should.Contains(body, `xxljob_admin_request_duration_seconds_count{endpoint="/api/callback"}`)
+
+	// The endpoint is not served if metrics are disabled.
+	e2 := xxljob.NewExecutor(xxljob.WithLogger(xxljob.DummyLogger()))
+	defer e2.Stop()
+	srv2 := httptest.NewServer(e2.Handler())
+	defer srv2.Close()
+	resp, err := resty.New().R().Get(srv2.URL + "/metrics")
+	should.NoError(err)
+	should.Equal(http.StatusNotFound, resp.StatusCode())
+}
@@ -0,0 +1,89 @@
+package xxljob
+
+import (
+	"context"
+	"time"
+)
+
+// Middleware wraps a job handler to add cross-cutting behaviour, e.g. logging, metrics or recovery.
+type Middleware func(JobHandler) JobHandler
+
+// Chain wraps the handler with the middlewares, the first middleware is the outermost one,
+// i.e. Chain(h, m1, m2) is equivalent to m1(m2(h)).
+// It can be used to add middlewares to a single handler:
+//
+//	e.AddJobHandler("demo", xxljob.Chain(demo, xxljob.Retry(3, time.Second)))
+func Chain(h JobHandler, middlewares ...Middleware) JobHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+
+	return h
+}
+
+// Use adds middlewares which are applied to all the job handlers, including the glue scripts.
+// They are applied in the order they are added, and wrap the middlewares of the handler itself.
+// It takes effect on the jobs triggered afterwards.
+func (e *Executor) Use(middlewares ...Middleware) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.middlewares = append(e.middlewares, middlewares...)
+}
+
+// Recover returns a middleware which converts a panic in the handler into an error,
+// and writes the stack trace into the job log.
+// Unlike the recovery of the executor, it takes effect even if FatalOnPanic is set.
+func Recover() Middleware {
+	return func(next JobHandler) JobHandler {
+		return func(ctx context.Context, param JobParam) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = panicError(ctx, r)
+				}
+			}()
+
+			return next(ctx, param)
+		}
+	}
+}
+
+// Timing returns a middleware which writes the execution time of the handler into the job log.
+func Timing() Middleware {
+	return func(next JobHandler) JobHandler {
+		return func(ctx context.Context, param JobParam) error {
+			start := time.Now()
+			err := next(ctx, param)
+			LoggerFromContext(ctx).Info("job handler takes %s", TruncateDuration(time.Since(start)))
+
+			return err
+		}
+	}
+}
+
+// Retry returns a middleware which retries the handler up to attempts times in total if it fails,
+// waiting for delay between attempts. It stops retrying once the job is cancelled.
+// Use RetryPolicy.Middleware for backoff and jitter.
+func Retry(attempts int, delay time.Duration) Middleware {
+	return RetryPolicy{MaxAttempts: attempts, InitialDelay: delay}.Middleware()
+}
+
+// ConcurrencyLimit returns a middleware which allows at most n handlers wrapped by it to run at the same time,
+// the others wait until a slot is free or the job is cancelled.
+// Each call returns a new limit, so the middleware can be shared by several handlers to limit them as a whole.
+func ConcurrencyLimit(n int) Middleware {
+	sem := make(chan struct{}, n)
+
+	return func(next JobHandler) JobHandler {
+		return func(ctx context.Context, param JobParam) error {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			defer func() { <-sem }()
+
+			return next(ctx, param)
+		}
+	}
+}
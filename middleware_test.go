@@ -0,0 +1,148 @@
+package xxljob_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hyperjiang/xxljob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	logDir := t.TempDir()
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(logDir),
+		xxljob.WithCallbackInterval("10ms"),
+	)
+	defer e.Stop()
+
+	var mu sync.Mutex
+	var trace []string
+	tracer := func(name string) xxljob.Middleware {
+		return func(next xxljob.JobHandler) xxljob.JobHandler {
+			return func(ctx context.Context, param xxljob.JobParam) error {
+				mu.Lock()
+				trace = append(trace, name)
+				mu.Unlock()
+				return next(ctx, param)
+			}
+		}
+	}
+
+	e.Use(tracer("global1"), tracer("global2"))
+	e.Use(xxljob.Timing())
+
+	var calls int32
+	e.AddJobHandler("flaky", xxljob.Chain(func(ctx context.Context, param xxljob.JobParam) error {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return errors.New("flaky")
+		}
+		return nil
+	}, tracer("local"), xxljob.Retry(3, time.Millisecond)))
+
+	now := time.Now()
+	should.NoError(e.TriggerJob(xxljob.RunParam{
+		JobID:           1,
+		ExecutorHandler: "flaky",
+		LogID:           1,
+		LogDateTime:     now.UnixNano() / int64(time.Millisecond),
+	}))
+	cb := <-callbacks
+	should.Equal(200, cb.HandleCode)
+	should.Equal(int32(3), atomic.LoadInt32(&calls))
+	should.Equal([]string{"global1", "global2", "local"}, trace)
+
+	b, err := os.ReadFile(filepath.Join(logDir, now.Format("2006-01-02"), "1.log"))
+	should.NoError(err)
+	should.Contains(string(b), "attempt 1/3 failed: flaky")
+	should.Contains(string(b), "attempt 2/3 failed: flaky")
+	should.Contains(string(b), "job handler takes")
+}
+
+func TestRecover(t *testing.T) {
+	should := require.New(t)
+
+	h := xxljob.Chain(func(ctx context.Context, param xxljob.JobParam) error {
+		panic("boom")
+	}, xxljob.Recover())
+
+	err := h(context.Background(), xxljob.JobParam{})
+	should.EqualError(err, "job handler panic: boom")
+}
+
+func TestRetry(t *testing.T) {
+	should := require.New(t)
+
+	var calls int
+	h := xxljob.Chain(func(ctx context.Context, param xxljob.JobParam) error {
+		calls++
+		return fmt.Errorf("fail %d", calls)
+	}, xxljob.Retry(3, time.Millisecond))
+
+	should.EqualError(h(context.Background(), xxljob.JobParam{}), "fail 3")
+	should.Equal(3, calls)
+
+	// It stops retrying once the context is done.
+	calls = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	should.EqualError(h(ctx, xxljob.JobParam{}), "fail 1")
+	should.Equal(1, calls)
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	should := require.New(t)
+
+	var running, peak int32
+	h := xxljob.Chain(func(ctx context.Context, param xxljob.JobParam) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 20)
+		atomic.AddInt32(&running, -1)
+		return nil
+	}, xxljob.ConcurrencyLimit(2))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			should.NoError(h(context.Background(), xxljob.JobParam{}))
+		}()
+	}
+	wg.Wait()
+	should.Equal(int32(2), atomic.LoadInt32(&peak))
+
+	// A waiting handler gives up when the job is cancelled.
+	block := make(chan struct{})
+	blocked := xxljob.Chain(func(ctx context.Context, param xxljob.JobParam) error {
+		<-block
+		return nil
+	}, xxljob.ConcurrencyLimit(1))
+	go blocked(context.Background(), xxljob.JobParam{})
+	time.Sleep(time.Millisecond * 10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	should.ErrorIs(blocked(ctx, xxljob.JobParam{}), context.DeadlineExceeded)
+	close(block)
+}
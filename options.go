@@ -11,10 +11,13 @@ const (
 	defaultAccessToken        = "default_token"
 	defaultCallbackBufferSize = 1024
 	defaultCallbackInterval   = "1s"
+	defaultCallbackSpoolSize  = 10000
 	defaultClientTimeout      = time.Second * 3
 	defaultRegisterInterval   = "10s"
 	defaultSizeLimit          = 10240
 	defaultLogDir             = "/tmp/xxl-job/jobhandler"
+	defaultHistorySize        = 100
+	defaultIsolationKillGrace = time.Second * 5
 	defaultLogRetentionDays   = 7
 	defaultLogCleanupInterval = "24h"
 
@@ -35,20 +38,50 @@ var defaultInterruptSignals = []os.Signal{
 type Options struct {
 	// client settings
 	AccessToken        string
+	AccessTokens       []string // extra tokens accepted on inbound requests, useful for token rotation
 	AppName            string
 	CallbackBufferSize int
 	CallbackInterval   string
-	ClientTimeout      time.Duration
-	Host               string
-	LogDir             string
-	LogRetentionDays   int
-	LogCleanupInterval string
-	Logger             Logger
-	RegisterInterval   string
-	SizeLimit          int64 // we will not log the response if its size exceeds the size limit
+	// durable callback spool settings, the callbacks are persisted on disk before delivery if enabled
+	CallbackSpool         bool
+	CallbackSpoolDir      string // LogDir/callback is used if empty
+	CallbackSpoolSize     int    // max number of callbacks in the spool
+	CallbackSpoolOverflow string // what to drop if the spool is full, SpoolDropOldest or SpoolDropNewest
+	ClientTimeout         time.Duration
+	ConcurrencyPolicy     string                  // what to do if the concurrency limits are reached, ConcurrencyWait or ConcurrencyReject
+	FatalOnPanic          bool                    // if true, a panicking job handler crashes the process instead of being recovered
+	GlueDir               string                  // directory to save the glue source files, each job has its own workspace in it, must not be writable by other users
+	GlueCommands          map[string][]string     // interpreter commands of the script glue types, no glue type is enabled by default
+	GlueCompilers         map[string]GlueCompiler // compilers of the glue types which are run in process, e.g. GlueGo
+	// health check settings
+	HealthRegisterTimeout    time.Duration // not ready if there is no successful registration in it, 3 register intervals if 0
+	HealthMaxCallbackBacklog int           // not ready if more callbacks are waiting, 0 means no limit
+	// execution history settings
+	HistorySize int    // number of recent executions kept for each handler, 0 disables the history
+	HistoryDir  string // directory to persist the history in, kept in memory only if empty
+	Host        string
+	// isolation settings, the isolated handlers are run in child processes which can be killed hard
+	IsolatedHandlers     []string
+	IsolationMemoryLimit int64         // max memory in bytes of the child process, 0 means no limit
+	IsolationCPULimit    int           // max cpu time in seconds of the child process, 0 means no limit
+	IsolationCgroup      string        // parent cgroup (v2) directory to put the child process in, linux only
+	IsolationKillGrace   time.Duration // how long to wait after SIGTERM before SIGKILL
+	LogDir               string
+	LogRetentionDays     int
+	LogCleanupInterval   string
+	Logger               Logger
+	MaxConcurrentJobs    int                        // max number of jobs running at the same time, 0 means no limit
+	Metrics              bool                       // whether to serve the metrics in Prometheus text format on /metrics
+	ParamsRedactor       func(params string) string // masks the sensitive job params shown on /status, RedactParams if nil
+	RegisterInterval     string
+	RetryPolicy          RetryPolicy   // retry policy of the retryable errors returned by the handlers without a retry policy
+	ShutdownDelay        time.Duration // how long Stop keeps the executor registered after failing the readiness
+	SizeLimit            int64         // we will not log the response if its size exceeds the size limit
+	Tracer               Tracer        // traces the job executions and the requests to xxl-job server
 
 	// http server settings
 	Port             int
+	PathPrefix       string // path prefix of the executor endpoints, e.g. "/xxl-job"
 	IdleTimeout      time.Duration
 	ReadTimeout      time.Duration
 	WriteTimeout     time.Duration
@@ -59,16 +92,23 @@ type Options struct {
 // NewOptions creates options with defaults
 func NewOptions(opts ...Option) Options {
 	var options = Options{
-		AccessToken:        defaultAccessToken,
-		CallbackBufferSize: defaultCallbackBufferSize,
-		CallbackInterval:   defaultCallbackInterval,
-		ClientTimeout:      defaultClientTimeout,
-		LogDir:             defaultLogDir,
-		LogRetentionDays:   defaultLogRetentionDays,
-		LogCleanupInterval: defaultLogCleanupInterval,
-		Logger:             DefaultLogger(),
-		RegisterInterval:   defaultRegisterInterval,
-		SizeLimit:          defaultSizeLimit,
+		AccessToken:           defaultAccessToken,
+		CallbackBufferSize:    defaultCallbackBufferSize,
+		CallbackInterval:      defaultCallbackInterval,
+		CallbackSpoolSize:     defaultCallbackSpoolSize,
+		CallbackSpoolOverflow: SpoolDropOldest,
+		ClientTimeout:         defaultClientTimeout,
+		ConcurrencyPolicy:     ConcurrencyWait,
+		GlueDir:               defaultGlueDir(),
+		HistorySize:           defaultHistorySize,
+		IsolationKillGrace:    defaultIsolationKillGrace,
+		LogDir:                defaultLogDir,
+		LogRetentionDays:      defaultLogRetentionDays,
+		LogCleanupInterval:    defaultLogCleanupInterval,
+		Logger:                DefaultLogger(),
+		RegisterInterval:      defaultRegisterInterval,
+		RetryPolicy:           DefaultRetryPolicy(),
+		SizeLimit:             defaultSizeLimit,
 
 		Port:             defaultPort,
 		IdleTimeout:      defaultIdleTimeout,
@@ -95,6 +135,14 @@ func WithAccessToken(token string) Option {
 	}
 }
 
+// WithAccessTokens sets extra access tokens which are accepted on inbound requests
+// besides AccessToken, so that the token can be rotated without downtime.
+func WithAccessTokens(tokens ...string) Option {
+	return func(o *Options) {
+		o.AccessTokens = tokens
+	}
+}
+
 // WithAppName sets app name.
 func WithAppName(appName string) Option {
 	return func(o *Options) {
@@ -116,6 +164,30 @@ func WithCallbackInterval(interval string) Option {
 	}
 }
 
+// WithCallbackSpool enables the durable callback spool in the given directory.
+// The callbacks are persisted before delivery, retried until acknowledged and replayed on startup.
+// LogDir/callback is used if dir is empty.
+func WithCallbackSpool(dir string) Option {
+	return func(o *Options) {
+		o.CallbackSpool = true
+		o.CallbackSpoolDir = dir
+	}
+}
+
+// WithCallbackSpoolSize sets the max number of callbacks in the spool.
+func WithCallbackSpoolSize(size int) Option {
+	return func(o *Options) {
+		o.CallbackSpoolSize = size
+	}
+}
+
+// WithCallbackSpoolOverflow sets the overflow policy of the spool, SpoolDropOldest or SpoolDropNewest.
+func WithCallbackSpoolOverflow(policy string) Option {
+	return func(o *Options) {
+		o.CallbackSpoolOverflow = policy
+	}
+}
+
 // WithClientTimeout sets client timeout.
 func WithClientTimeout(timeout time.Duration) Option {
 	return func(o *Options) {
@@ -123,6 +195,95 @@ func WithClientTimeout(timeout time.Duration) Option {
 	}
 }
 
+// WithConcurrencyPolicy sets what to do if the concurrency limits are reached, ConcurrencyWait or ConcurrencyReject.
+// The jobs queued behind the jobs of the same id always wait.
+func WithConcurrencyPolicy(policy string) Option {
+	return func(o *Options) {
+		o.ConcurrencyPolicy = policy
+	}
+}
+
+// WithFatalOnPanic sets whether a panicking job handler crashes the process.
+// By default the panic is recovered and the job is reported as failed.
+func WithFatalOnPanic(fatal bool) Option {
+	return func(o *Options) {
+		o.FatalOnPanic = fatal
+	}
+}
+
+// WithHealthRegisterTimeout sets how long the executor stays ready without a successful registration.
+// It is 3 register intervals by default.
+func WithHealthRegisterTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.HealthRegisterTimeout = timeout
+	}
+}
+
+// WithHealthMaxCallbackBacklog sets the max number of callbacks waiting to be delivered for the executor to be ready.
+func WithHealthMaxCallbackBacklog(n int) Option {
+	return func(o *Options) {
+		o.HealthMaxCallbackBacklog = n
+	}
+}
+
+// WithHistorySize sets how many recent executions are kept for each handler, 0 disables the history.
+func WithHistorySize(size int) Option {
+	return func(o *Options) {
+		o.HistorySize = size
+	}
+}
+
+// WithHistoryDir sets the directory to persist the execution history in,
+// so that it survives restarts.
+func WithHistoryDir(dir string) Option {
+	return func(o *Options) {
+		o.HistoryDir = dir
+	}
+}
+
+// WithGlueDir sets the directory to save the glue source files.
+// It is created with 0700 permissions, and it must not be writable by other users, e.g. a shared directory under /tmp.
+func WithGlueDir(dir string) Option {
+	return func(o *Options) {
+		o.GlueDir = dir
+	}
+}
+
+// WithGlueCommand enables a script glue type with the given interpreter command,
+// e.g. WithGlueCommand(GluePython, "python3", "-u").
+func WithGlueCommand(glueType string, command ...string) Option {
+	return func(o *Options) {
+		if o.GlueCommands == nil {
+			o.GlueCommands = make(map[string][]string)
+		}
+		o.GlueCommands[glueType] = command
+	}
+}
+
+// WithDefaultGlueCommands enables all the script glue types with the same interpreters as the java executor.
+// The glue scripts are edited in xxl-job admin and run on the executor host, so only enable them if the admin is trusted.
+func WithDefaultGlueCommands() Option {
+	return func(o *Options) {
+		if o.GlueCommands == nil {
+			o.GlueCommands = make(map[string][]string)
+		}
+		for glueType, command := range defaultGlueCommands() {
+			o.GlueCommands[glueType] = command
+		}
+	}
+}
+
+// WithGlueCompiler sets the compiler of a glue type whose source is compiled into a job handler,
+// e.g. WithGlueCompiler(GlueGo, compile) with a compile function built on an embedded go interpreter.
+func WithGlueCompiler(glueType string, compiler GlueCompiler) Option {
+	return func(o *Options) {
+		if o.GlueCompilers == nil {
+			o.GlueCompilers = make(map[string]GlueCompiler)
+		}
+		o.GlueCompilers[glueType] = compiler
+	}
+}
+
 // WithHost sets xxl-job server address.
 func WithHost(host string) Option {
 	return func(o *Options) {
@@ -133,6 +294,45 @@ func WithHost(host string) Option {
 	}
 }
 
+// WithIsolatedHandlers sets the job handlers which are run in child processes.
+// The child process re-executes the current binary, so the handlers must be registered
+// before Start or RunIsolated is called.
+func WithIsolatedHandlers(names ...string) Option {
+	return func(o *Options) {
+		o.IsolatedHandlers = names
+	}
+}
+
+// WithIsolationMemoryLimit sets the max memory in bytes of the isolated child process.
+func WithIsolationMemoryLimit(limit int64) Option {
+	return func(o *Options) {
+		o.IsolationMemoryLimit = limit
+	}
+}
+
+// WithIsolationCPULimit sets the max cpu time in seconds of the isolated child process.
+func WithIsolationCPULimit(seconds int) Option {
+	return func(o *Options) {
+		o.IsolationCPULimit = seconds
+	}
+}
+
+// WithIsolationCgroup sets the parent cgroup (v2) directory of the isolated child processes,
+// each child is put into its own cgroup with the memory limit. It only works on linux.
+func WithIsolationCgroup(dir string) Option {
+	return func(o *Options) {
+		o.IsolationCgroup = dir
+	}
+}
+
+// WithIsolationKillGrace sets how long to wait for the isolated child process to exit
+// after SIGTERM before it is killed by SIGKILL.
+func WithIsolationKillGrace(grace time.Duration) Option {
+	return func(o *Options) {
+		o.IsolationKillGrace = grace
+	}
+}
+
 // WithLogDir sets log directory for job handlers.
 func WithLogDir(dir string) Option {
 	return func(o *Options) {
@@ -170,6 +370,23 @@ func WithRegisterInterval(interval string) Option {
 	}
 }
 
+// WithDefaultRetryPolicy sets the retry policy of the retryable errors returned by the handlers
+// without a retry policy, see Retryable. Set MaxAttempts to 1 to disable it.
+func WithDefaultRetryPolicy(policy RetryPolicy) Option {
+	return func(o *Options) {
+		o.RetryPolicy = policy
+	}
+}
+
+// WithShutdownDelay sets how long Stop keeps the executor registered after failing the readiness,
+// so that the readiness probe notices it before the executor is deregistered.
+// It should be longer than the period of the readiness probe.
+func WithShutdownDelay(delay time.Duration) Option {
+	return func(o *Options) {
+		o.ShutdownDelay = delay
+	}
+}
+
 // WithSizeLimit sets size limit.
 func WithSizeLimit(sizeLimit int64) Option {
 	return func(o *Options) {
@@ -177,6 +394,36 @@ func WithSizeLimit(sizeLimit int64) Option {
 	}
 }
 
+// WithMaxConcurrentJobs sets the max number of jobs running at the same time in the executor.
+// If it is reached, the executor reports busy in idle beat, so that xxl-job server can pick another executor.
+func WithMaxConcurrentJobs(n int) Option {
+	return func(o *Options) {
+		o.MaxConcurrentJobs = n
+	}
+}
+
+// WithMetrics sets whether to serve the executor metrics in Prometheus text format on /metrics.
+// The endpoint does not require the access token.
+func WithMetrics(enabled bool) Option {
+	return func(o *Options) {
+		o.Metrics = enabled
+	}
+}
+
+// WithParamsRedactor sets the function to mask the sensitive job params shown by RunningJobs and /status.
+func WithParamsRedactor(redactor func(params string) string) Option {
+	return func(o *Options) {
+		o.ParamsRedactor = redactor
+	}
+}
+
+// WithTracer sets the tracer of the job executions and the requests to xxl-job server.
+func WithTracer(tracer Tracer) Option {
+	return func(o *Options) {
+		o.Tracer = tracer
+	}
+}
+
 // WithPort sets service port.
 func WithPort(port int) Option {
 	return func(o *Options) {
@@ -184,6 +431,18 @@ func WithPort(port int) Option {
 	}
 }
 
+// WithPathPrefix sets the path prefix of the executor endpoints,
+// it is useful when mounting the executor handler into an existing http server.
+func WithPathPrefix(prefix string) Option {
+	return func(o *Options) {
+		prefix = strings.TrimRight(prefix, "/")
+		if prefix != "" && !strings.HasPrefix(prefix, "/") {
+			prefix = "/" + prefix
+		}
+		o.PathPrefix = prefix
+	}
+}
+
 // WithIdleTimeout sets idle timeout.
 func WithIdleTimeout(timeout time.Duration) Option {
 	return func(o *Options) {
@@ -2,6 +2,7 @@ package xxljob_test
 
 import (
 	"os"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -18,9 +19,25 @@ func TestOptions(t *testing.T) {
 	should.Equal("default_token", opts.AccessToken)
 	should.Equal(1024, opts.CallbackBufferSize)
 	should.Equal("1s", opts.CallbackInterval)
+	should.False(opts.CallbackSpool)
+	should.Equal(10000, opts.CallbackSpoolSize)
+	should.Equal(xxljob.SpoolDropOldest, opts.CallbackSpoolOverflow)
 	should.Equal(time.Second*3, opts.ClientTimeout)
+	should.Empty(opts.GlueCommands)
 	should.Empty(opts.Host)
+	should.Equal(time.Second*5, opts.IsolationKillGrace)
+	should.Equal(xxljob.DefaultRetryPolicy(), opts.RetryPolicy)
+	should.Equal(xxljob.ConcurrencyWait, opts.ConcurrencyPolicy)
+	should.Zero(opts.MaxConcurrentJobs)
+	should.False(opts.Metrics)
+	should.Nil(opts.Tracer)
+	should.Nil(opts.ParamsRedactor)
+	should.Zero(opts.HealthRegisterTimeout)
+	should.Zero(opts.HealthMaxCallbackBacklog)
+	should.Equal(100, opts.HistorySize)
+	should.Empty(opts.HistoryDir)
 	should.Equal("10s", opts.RegisterInterval)
+	should.Zero(opts.ShutdownDelay)
 	should.Equal(int64(10240), opts.SizeLimit)
 
 	should.Equal(9999, opts.Port)
@@ -32,16 +49,42 @@ func TestOptions(t *testing.T) {
 	// override default options
 	opts2 := xxljob.NewOptions(
 		xxljob.WithAccessToken("abc"),
+		xxljob.WithAccessTokens("def", "ghi"),
 		xxljob.WithAppName(appName),
 		xxljob.WithCallbackBufferSize(100),
 		xxljob.WithCallbackInterval("5s"),
+		xxljob.WithCallbackSpool("/tmp/spool"),
+		xxljob.WithCallbackSpoolSize(10),
+		xxljob.WithCallbackSpoolOverflow(xxljob.SpoolDropNewest),
 		xxljob.WithClientTimeout(time.Second),
+		xxljob.WithFatalOnPanic(true),
+		xxljob.WithGlueDir("/tmp/glue"),
+		xxljob.WithDefaultGlueCommands(),
+		xxljob.WithGlueCommand(xxljob.GluePython, "python3", "-u"),
+		xxljob.WithGlueCompiler(xxljob.GlueGo, func(string) (xxljob.JobHandler, error) { return nil, nil }),
 		xxljob.WithHost(host),
+		xxljob.WithIsolatedHandlers("a", "b"),
+		xxljob.WithMaxConcurrentJobs(8),
+		xxljob.WithMetrics(true),
+		xxljob.WithHealthRegisterTimeout(time.Minute),
+		xxljob.WithHealthMaxCallbackBacklog(500),
+		xxljob.WithShutdownDelay(time.Second*5),
+		xxljob.WithHistorySize(10),
+		xxljob.WithHistoryDir("/tmp/history"),
+		xxljob.WithTracer(xxljob.NewInMemoryTracer()),
+		xxljob.WithParamsRedactor(strings.ToUpper),
+		xxljob.WithConcurrencyPolicy(xxljob.ConcurrencyReject),
+		xxljob.WithDefaultRetryPolicy(xxljob.RetryPolicy{MaxAttempts: 1}),
+		xxljob.WithIsolationMemoryLimit(1<<30),
+		xxljob.WithIsolationCPULimit(60),
+		xxljob.WithIsolationCgroup("/sys/fs/cgroup/xxljob"),
+		xxljob.WithIsolationKillGrace(time.Second),
 		xxljob.WithLogger(xxljob.DummyLogger()),
 		xxljob.WithRegisterInterval("15s"),
 		xxljob.WithSizeLimit(20000),
 
 		xxljob.WithPort(8080),
+		xxljob.WithPathPrefix("xxl-job/"),
 		xxljob.WithIdleTimeout(time.Second*10),
 		xxljob.WithReadTimeout(time.Second),
 		xxljob.WithWriteTimeout(time.Second*2),
@@ -50,15 +93,42 @@ func TestOptions(t *testing.T) {
 	)
 
 	should.Equal("abc", opts2.AccessToken)
+	should.Equal([]string{"def", "ghi"}, opts2.AccessTokens)
 	should.Equal(appName, opts2.AppName)
 	should.Equal(100, opts2.CallbackBufferSize)
 	should.Equal("5s", opts2.CallbackInterval)
+	should.True(opts2.CallbackSpool)
+	should.Equal("/tmp/spool", opts2.CallbackSpoolDir)
+	should.Equal(10, opts2.CallbackSpoolSize)
+	should.Equal(xxljob.SpoolDropNewest, opts2.CallbackSpoolOverflow)
 	should.Equal(time.Second, opts2.ClientTimeout)
+	should.True(opts2.FatalOnPanic)
+	should.Equal("/tmp/glue", opts2.GlueDir)
+	should.Equal([]string{"python3", "-u"}, opts2.GlueCommands[xxljob.GluePython])
+	should.Equal([]string{"bash"}, opts2.GlueCommands[xxljob.GlueShell])
+	should.Contains(opts2.GlueCompilers, xxljob.GlueGo)
 	should.Equal("http://"+host, opts2.Host)
+	should.Equal([]string{"a", "b"}, opts2.IsolatedHandlers)
+	should.Equal(8, opts2.MaxConcurrentJobs)
+	should.True(opts2.Metrics)
+	should.Equal(time.Minute, opts2.HealthRegisterTimeout)
+	should.Equal(500, opts2.HealthMaxCallbackBacklog)
+	should.Equal(10, opts2.HistorySize)
+	should.Equal("/tmp/history", opts2.HistoryDir)
+	should.IsType(&xxljob.InMemoryTracer{}, opts2.Tracer)
+	should.Equal("ABC", opts2.ParamsRedactor("abc"))
+	should.Equal(xxljob.ConcurrencyReject, opts2.ConcurrencyPolicy)
+	should.Equal(1, opts2.RetryPolicy.MaxAttempts)
+	should.Equal(int64(1<<30), opts2.IsolationMemoryLimit)
+	should.Equal(60, opts2.IsolationCPULimit)
+	should.Equal("/sys/fs/cgroup/xxljob", opts2.IsolationCgroup)
+	should.Equal(time.Second, opts2.IsolationKillGrace)
 	should.Equal("15s", opts2.RegisterInterval)
+	should.Equal(time.Second*5, opts2.ShutdownDelay)
 	should.Equal(int64(20000), opts2.SizeLimit)
 
 	should.Equal(8080, opts2.Port)
+	should.Equal("/xxl-job", opts2.PathPrefix)
 	should.Equal(time.Second*10, opts2.IdleTimeout)
 	should.Equal(time.Second, opts2.ReadTimeout)
 	should.Equal(time.Second*2, opts2.WriteTimeout)
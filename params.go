@@ -19,6 +19,27 @@ type CallbackParam struct {
 
 /* Below are the parameters of the remote server to call the local client's HTTP endpoints */
 
+// RunNowParam is used to run a job handler locally without xxl-job server.
+type RunNowParam struct {
+	JobID         int    `json:"jobId"`
+	Handler       string `json:"handler"`
+	Params        string `json:"params"`
+	BlockStrategy string `json:"blockStrategy"`
+	Timeout       int    `json:"timeout"` // job execution timeout in seconds
+	ShardingIndex int    `json:"shardingIndex"`
+	ShardingTotal int    `json:"shardingTotal"`
+	Async         bool   `json:"async"` // return the log id once the job is triggered instead of waiting for the result
+}
+
+// HistoryParam is used to query the recent job executions, the zero fields are not filtered.
+type HistoryParam struct {
+	Handler string `json:"handler"`
+	JobID   int    `json:"jobId"`
+	Outcome string `json:"outcome"`
+	Since   int64  `json:"since"` // timestamp in milliseconds, only the executions finished since then are returned
+	Limit   int    `json:"limit"`
+}
+
 // IdleBeatParam is for idle checking.
 type IdleBeatParam struct {
 	JobID int `json:"jobId"`
@@ -45,9 +66,9 @@ type RunParam struct {
 	ExecutorTimeout       int    `json:"executorTimeout"` // job execution timeout in seconds
 	LogID                 int64  `json:"logId"`
 	LogDateTime           int64  `json:"logDateTime"`    // timestamp in milliseconds
-	GlueType              string `json:"glueType"`       // unsupported in go executor
-	GlueSource            string `json:"glueSource"`     // unsupported in go executor
-	GlueUpdatetime        int64  `json:"glueUpdatetime"` // unsupported in go executor
+	GlueType              string `json:"glueType"`       // BEAN or the script glue types, e.g. GLUE_SHELL
+	GlueSource            string `json:"glueSource"`     // source code of the glue script
+	GlueUpdatetime        int64  `json:"glueUpdatetime"` // update time of the glue source, used as its version
 	BroadcastIndex        int    `json:"broadcastIndex"`
 	BroadcastTotal        int    `json:"broadcastTotal"`
 }
@@ -0,0 +1,44 @@
+//go:build !windows
+// +build !windows
+
+package xxljob
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes the command run in a new process group.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminateProcessGroup asks the process group of the command to exit.
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+// killProcessGroup kills the process group of the command, including the child processes.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// setResourceLimits limits the virtual memory in bytes and cpu time in seconds of the current process.
+func setResourceLimits(memory int64, cpu int) error {
+	if memory > 0 {
+		limit := &syscall.Rlimit{Cur: uint64(memory), Max: uint64(memory)}
+		if err := syscall.Setrlimit(syscall.RLIMIT_AS, limit); err != nil {
+			return err
+		}
+	}
+
+	if cpu > 0 {
+		// The process receives SIGXCPU at the soft limit and SIGKILL at the hard limit.
+		limit := &syscall.Rlimit{Cur: uint64(cpu), Max: uint64(cpu) + 1}
+		if err := syscall.Setrlimit(syscall.RLIMIT_CPU, limit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
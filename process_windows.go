@@ -0,0 +1,31 @@
+//go:build windows
+// +build windows
+
+package xxljob
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// setProcessGroup does nothing on windows.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminateProcessGroup kills the process of the command since there is no SIGTERM on windows.
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// killProcessGroup kills the process of the command.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// setResourceLimits is not supported on windows.
+func setResourceLimits(memory int64, cpu int) error {
+	if memory > 0 || cpu > 0 {
+		return errors.New("resource limits are not supported on windows")
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package xxljob
+
+// jobQueue is the FIFO queue of the jobs with the same job id.
+// Jobs in the queue are run one by one in the order of arrival.
+type jobQueue struct {
+	running *Job
+	pending []*Job
+}
+
+// size returns the number of running and pending jobs.
+func (q *jobQueue) size() int {
+	n := len(q.pending)
+	if q.running != nil {
+		n++
+	}
+
+	return n
+}
+
+// find returns the running or pending job with the given log id.
+func (q *jobQueue) find(logID int64) *Job {
+	if q.running != nil && q.running.LogID == logID {
+		return q.running
+	}
+
+	for _, job := range q.pending {
+		if job.LogID == logID {
+			return job
+		}
+	}
+
+	return nil
+}
+
+// remove removes the pending job with the given log id and returns it.
+func (q *jobQueue) remove(logID int64) *Job {
+	for i, job := range q.pending {
+		if job.LogID == logID {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return job
+		}
+	}
+
+	return nil
+}
+
+// pop removes the first pending job and returns it.
+func (q *jobQueue) pop() *Job {
+	if len(q.pending) == 0 {
+		return nil
+	}
+
+	job := q.pending[0]
+	q.pending = q.pending[1:]
+
+	return job
+}
@@ -0,0 +1,14 @@
+//go:build go1.20
+// +build go1.20
+
+package xxljob
+
+import (
+	"net/http"
+	"time"
+)
+
+// clearWriteDeadline removes the write deadline of the response set by the http server.
+func clearWriteDeadline(w http.ResponseWriter) error {
+	return http.NewResponseController(w).SetWriteDeadline(time.Time{})
+}
@@ -0,0 +1,14 @@
+//go:build !go1.20
+// +build !go1.20
+
+package xxljob
+
+import (
+	"errors"
+	"net/http"
+)
+
+// clearWriteDeadline is not supported before go 1.20.
+func clearWriteDeadline(w http.ResponseWriter) error {
+	return errors.New("write deadline cannot be changed before go 1.20")
+}
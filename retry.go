@@ -0,0 +1,143 @@
+package xxljob
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy defines how a failed handler is retried by the executor within the same log id.
+// Only the final outcome is reported to xxl-job server.
+type RetryPolicy struct {
+	MaxAttempts  int                  // max attempts in total, including the first one
+	InitialDelay time.Duration        // delay before the first retry
+	MaxDelay     time.Duration        // max delay between attempts, 0 means no limit
+	Multiplier   float64              // the delay is multiplied by it after each retry, values below 1 are treated as 1
+	Jitter       float64              // randomizes the delay by up to this fraction, e.g. 0.2 means ±20%
+	RetryIf      func(err error) bool // decides whether the error is retried, nil means all errors are retried
+}
+
+// DefaultRetryPolicy returns the policy used for the retryable errors of the handlers without a retry policy.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:  3,
+		InitialDelay: time.Second,
+		MaxDelay:     time.Minute,
+		Multiplier:   2,
+		Jitter:       0.2,
+	}
+}
+
+// retryableError is an error which can be retried.
+type retryableError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// Retryable marks the error as transient, so that the job is retried by the executor
+// even if its handler has no retry policy. It returns nil if err is nil.
+func Retryable(err error) error {
+	return RetryableAfter(err, 0)
+}
+
+// RetryableAfter marks the error as transient and asks the executor to retry after the given delay,
+// which overrides the delay of the retry policy. It returns nil if err is nil.
+func RetryableAfter(err error, after time.Duration) error {
+	if err == nil {
+		return nil
+	}
+
+	return &retryableError{err: err, after: after}
+}
+
+// IsRetryable checks if the error is marked as retryable.
+func IsRetryable(err error) bool {
+	var re *retryableError
+	return errors.As(err, &re)
+}
+
+// retryAfter returns the delay requested by a retryable error, 0 if there is none.
+func retryAfter(err error) time.Duration {
+	var re *retryableError
+	if errors.As(err, &re) {
+		return re.after
+	}
+
+	return 0
+}
+
+// delay returns how long to wait after the given failed attempt, which starts from 1.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	d := float64(p.InitialDelay) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (rand.Float64()*2 - 1)
+	}
+
+	return time.Duration(d)
+}
+
+// Middleware returns a middleware which retries the handler according to the policy.
+// Each failed attempt is written into the job log, and it stops retrying once the job is cancelled.
+func (p RetryPolicy) Middleware() Middleware {
+	return func(next JobHandler) JobHandler {
+		return func(ctx context.Context, param JobParam) error {
+			var err error
+			for i := 1; ; i++ {
+				err = next(ctx, param)
+				if err == nil || i >= p.MaxAttempts || ctx.Err() != nil {
+					return err
+				}
+				if p.RetryIf != nil && !p.RetryIf(err) {
+					return err
+				}
+
+				delay := p.delay(i)
+				if after := retryAfter(err); after > 0 {
+					delay = after
+				}
+				LoggerFromContext(ctx).Error("attempt %d/%d failed: %v, retry in %s", i, p.MaxAttempts, err, delay.Truncate(time.Millisecond))
+
+				select {
+				case <-ctx.Done():
+					return err
+				case <-time.After(delay):
+				}
+			}
+		}
+	}
+}
+
+// retryRetryable checks if the retryable errors of the job should be retried by the executor retry policy,
+// which is true unless the handler has its own retry policy.
+func (e *Executor) retryRetryable(params RunParam) bool {
+	if e.RetryPolicy.MaxAttempts <= 1 {
+		return false
+	}
+
+	if params.GlueType == "" || params.GlueType == GlueBean {
+		if options, ok := e.GetHandlerOptions(params.ExecutorHandler); ok && options.RetryPolicy != nil {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,131 @@
+package xxljob_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hyperjiang/xxljob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryableError(t *testing.T) {
+	should := require.New(t)
+
+	should.Nil(xxljob.Retryable(nil))
+
+	base := errors.New("connection reset")
+	err := fmt.Errorf("sync failed: %w", xxljob.RetryableAfter(base, time.Second))
+	should.True(xxljob.IsRetryable(err))
+	should.True(errors.Is(err, base))
+	should.Equal("sync failed: connection reset", err.Error())
+	should.False(xxljob.IsRetryable(base))
+}
+
+func TestRetryPolicy(t *testing.T) {
+	should := require.New(t)
+
+	var calls int
+	h := xxljob.Chain(func(ctx context.Context, param xxljob.JobParam) error {
+		calls++
+		if calls == 2 {
+			return errors.New("permanent")
+		}
+		return xxljob.Retryable(errors.New("transient"))
+	}, xxljob.RetryPolicy{
+		MaxAttempts:  5,
+		InitialDelay: time.Millisecond,
+		MaxDelay:     time.Millisecond * 2,
+		Multiplier:   2,
+		Jitter:       0.5,
+		RetryIf:      xxljob.IsRetryable,
+	}.Middleware())
+
+	should.EqualError(h(context.Background(), xxljob.JobParam{}), "permanent")
+	should.Equal(2, calls)
+
+	// The delay requested by the error overrides the policy.
+	calls = 0
+	h = xxljob.Chain(func(ctx context.Context, param xxljob.JobParam) error {
+		calls++
+		return xxljob.RetryableAfter(errors.New("busy"), time.Millisecond*50)
+	}, xxljob.RetryPolicy{MaxAttempts: 2, InitialDelay: time.Hour}.Middleware())
+
+	start := time.Now()
+	should.EqualError(h(context.Background(), xxljob.JobParam{}), "busy")
+	should.Equal(2, calls)
+	should.Less(time.Since(start), time.Second)
+}
+
+func TestExecutorRetry(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	logDir := t.TempDir()
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(logDir),
+		xxljob.WithCallbackInterval("10ms"),
+		xxljob.WithDefaultRetryPolicy(xxljob.RetryPolicy{MaxAttempts: 3, InitialDelay: time.Millisecond}),
+	)
+	defer e.Stop()
+
+	var transient, permanent, own int32
+	e.AddJobHandler("transient", func(ctx context.Context, param xxljob.JobParam) error {
+		if atomic.AddInt32(&transient, 1) < 3 {
+			return xxljob.Retryable(errors.New("transient"))
+		}
+		return nil
+	})
+	e.AddJobHandler("permanent", func(ctx context.Context, param xxljob.JobParam) error {
+		atomic.AddInt32(&permanent, 1)
+		return errors.New("permanent")
+	})
+	e.AddJobHandler("own", func(ctx context.Context, param xxljob.JobParam) error {
+		atomic.AddInt32(&own, 1)
+		return xxljob.Retryable(errors.New("transient"))
+	}, xxljob.WithRetry(2, time.Millisecond))
+
+	now := time.Now()
+	run := func(jobID int, logID int64, handler string) xxljob.CallbackParam {
+		should.NoError(e.TriggerJob(xxljob.RunParam{
+			JobID:           jobID,
+			ExecutorHandler: handler,
+			LogID:           logID,
+			LogDateTime:     now.UnixNano() / int64(time.Millisecond),
+		}))
+		return <-callbacks
+	}
+
+	// The retryable error is retried within the same log id, and only the final outcome is reported.
+	cb := run(1, 1, "transient")
+	should.Equal(int64(1), cb.LogID)
+	should.Equal(200, cb.HandleCode)
+	should.Equal(int32(3), atomic.LoadInt32(&transient))
+
+	b, err := os.ReadFile(filepath.Join(logDir, now.Format("2006-01-02"), "1.log"))
+	should.NoError(err)
+	should.Contains(string(b), "attempt 1/3 failed: transient")
+	should.Contains(string(b), "attempt 2/3 failed: transient")
+
+	cb = run(2, 2, "permanent")
+	should.Equal(500, cb.HandleCode)
+	should.Equal("permanent", cb.HandleMsg)
+	should.Equal(int32(1), atomic.LoadInt32(&permanent))
+
+	// The retry policy of the handler takes precedence.
+	cb = run(3, 3, "own")
+	should.Equal(500, cb.HandleCode)
+	should.Equal("transient", cb.HandleMsg)
+	should.Equal(int32(2), atomic.LoadInt32(&own))
+
+	should.Empty(callbacks)
+}
@@ -0,0 +1,210 @@
+package xxljob
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SpoolDropOldest: if the callback spool is full, the oldest callback will be dropped. (default)
+	SpoolDropOldest = "DROP_OLDEST"
+	// SpoolDropNewest: if the callback spool is full, the new callback will be dropped.
+	SpoolDropNewest = "DROP_NEWEST"
+
+	spoolFileExt   = ".json"
+	spoolBatchSize = 100
+	spoolBaseDelay = time.Second
+	spoolMaxDelay  = time.Minute
+)
+
+// spoolEntry is a callback persisted in the spool.
+type spoolEntry struct {
+	seq   int64
+	param CallbackParam
+}
+
+// callbackSpool is a write-ahead spool which persists callbacks on disk before delivery,
+// each callback is saved in a single file named by its sequence number.
+type callbackSpool struct {
+	dir      string
+	size     int
+	overflow string
+
+	mu      sync.Mutex
+	entries []spoolEntry
+	lastSeq int64
+
+	// delivery state, only accessed by the notifier
+	attempts int
+	nextTry  time.Time
+}
+
+// newCallbackSpool creates a spool in dir and loads the callbacks which are not delivered yet.
+func newCallbackSpool(dir string, size int, overflow string) (*callbackSpool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &callbackSpool{
+		dir:      dir,
+		size:     size,
+		overflow: overflow,
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// load reads the persisted callbacks in the order of sequence.
+func (s *callbackSpool) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, spoolFileExt) {
+			continue
+		}
+
+		seq, err := strconv.ParseInt(strings.TrimSuffix(name, spoolFileExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		b, err := os.ReadFile(filepath.Join(s.dir, name))
+		if err != nil {
+			return err
+		}
+
+		var param CallbackParam
+		if err := json.Unmarshal(b, &param); err != nil {
+			// A broken file can never be delivered, discard it.
+			_ = os.Remove(filepath.Join(s.dir, name))
+			continue
+		}
+
+		s.entries = append(s.entries, spoolEntry{seq: seq, param: param})
+		if seq > s.lastSeq {
+			s.lastSeq = seq
+		}
+	}
+
+	sort.Slice(s.entries, func(i, j int) bool {
+		return s.entries[i].seq < s.entries[j].seq
+	})
+
+	return nil
+}
+
+// file returns the file path of the given sequence.
+func (s *callbackSpool) file(seq int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%019d%s", seq, spoolFileExt))
+}
+
+// put persists a callback. If the spool is full, a callback is dropped according to the overflow policy.
+// It returns the dropped callback if any.
+func (s *callbackSpool) put(param CallbackParam) (*CallbackParam, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size > 0 && len(s.entries) >= s.size && s.overflow == SpoolDropNewest {
+		return &param, nil
+	}
+
+	seq := time.Now().UnixNano()
+	if seq <= s.lastSeq {
+		seq = s.lastSeq + 1
+	}
+
+	b, err := json.Marshal(param)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeFileAtomic(s.file(seq), b, 0644); err != nil {
+		return nil, err
+	}
+
+	s.lastSeq = seq
+	s.entries = append(s.entries, spoolEntry{seq: seq, param: param})
+
+	if s.size > 0 && len(s.entries) > s.size {
+		oldest := s.entries[0]
+		s.entries = s.entries[1:]
+		_ = os.Remove(s.file(oldest.seq))
+		return &oldest.param, nil
+	}
+
+	return nil, nil
+}
+
+// peek returns at most n callbacks in the order of sequence.
+func (s *callbackSpool) peek(n int) []spoolEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n > len(s.entries) {
+		n = len(s.entries)
+	}
+
+	return append([]spoolEntry(nil), s.entries[:n]...)
+}
+
+// ack removes the delivered callbacks.
+func (s *callbackSpool) ack(delivered []spoolEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acked := make(map[int64]bool, len(delivered))
+	for _, entry := range delivered {
+		acked[entry.seq] = true
+		_ = os.Remove(s.file(entry.seq))
+	}
+
+	entries := s.entries[:0]
+	for _, entry := range s.entries {
+		if !acked[entry.seq] {
+			entries = append(entries, entry)
+		}
+	}
+	s.entries = entries
+}
+
+// count returns the number of callbacks in the spool.
+func (s *callbackSpool) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.entries)
+}
+
+// backoff records a failed delivery and schedules the next try with exponential backoff.
+func (s *callbackSpool) backoff() time.Duration {
+	delay := spoolBaseDelay << uint(s.attempts)
+	if delay > spoolMaxDelay || delay <= 0 {
+		delay = spoolMaxDelay
+	}
+
+	s.attempts++
+	s.nextTry = time.Now().Add(delay)
+
+	return delay
+}
+
+// reset resets the delivery state after a successful delivery.
+func (s *callbackSpool) reset() {
+	s.attempts = 0
+	s.nextTry = time.Time{}
+}
@@ -0,0 +1,130 @@
+package xxljob_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hyperjiang/xxljob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallbackSpool(t *testing.T) {
+	should := require.New(t)
+
+	spoolDir := t.TempDir()
+	handler := func(ctx context.Context, param xxljob.JobParam) error {
+		return nil
+	}
+
+	// xxl-job server is down, the callbacks are kept in the spool
+	e1 := xxljob.NewExecutor(
+		xxljob.WithHost("127.0.0.1:1"),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(""),
+		xxljob.WithCallbackSpool(spoolDir),
+		xxljob.WithCallbackSpoolSize(2),
+		xxljob.WithCallbackSpoolOverflow(xxljob.SpoolDropOldest),
+		xxljob.WithWaitTimeout(time.Second),
+	)
+	e1.AddJobHandler("spoolHandler", handler)
+
+	// jobs of the same id run in serial, so the callbacks are spooled in order
+	for i := int64(1); i <= 3; i++ {
+		should.NoError(e1.TriggerJob(xxljob.RunParam{JobID: 1, ExecutorHandler: "spoolHandler", LogID: i}))
+	}
+	should.NoError(e1.Stop())
+
+	files, err := os.ReadDir(spoolDir)
+	should.NoError(err)
+	should.Len(files, 2)
+
+	// the callbacks are replayed after restart
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	e2 := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(""),
+		xxljob.WithCallbackSpool(spoolDir),
+		xxljob.WithCallbackInterval("10ms"),
+	)
+	defer e2.Stop()
+
+	logIDs := make(map[int64]bool)
+	for i := 0; i < 2; i++ {
+		cb := <-callbacks
+		should.Equal(200, cb.HandleCode)
+		logIDs[cb.LogID] = true
+	}
+	should.Len(logIDs, 2)
+	should.False(logIDs[1], "the oldest callback should be dropped")
+
+	should.Eventually(func() bool {
+		files, _ := os.ReadDir(spoolDir)
+		return len(files) == 0
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestCallbackSpoolRejected(t *testing.T) {
+	should := require.New(t)
+
+	// xxl-job server rejects the first delivery, e.g. because the access token is being rotated
+	var attempts int32
+	delivered := make(chan int64, 1)
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/api/callback" {
+			fmt.Fprintln(w, xxljob.NewSuccResponse().String())
+			return
+		}
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			fmt.Fprintln(w, xxljob.NewErrorResponse("The access token is wrong.").String())
+			return
+		}
+		var params []xxljob.CallbackParam
+		_ = json.NewDecoder(r.Body).Decode(&params)
+		for _, p := range params {
+			delivered <- p.LogID
+		}
+		fmt.Fprintln(w, xxljob.NewSuccResponse().String())
+	}))
+	defer admin.Close()
+
+	spoolDir := t.TempDir()
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(""),
+		xxljob.WithCallbackSpool(spoolDir),
+		xxljob.WithCallbackInterval("10ms"),
+	)
+	defer e.Stop()
+
+	e.AddJobHandler("spoolHandler", func(ctx context.Context, param xxljob.JobParam) error { return nil })
+	should.NoError(e.TriggerJob(xxljob.RunParam{JobID: 1, ExecutorHandler: "spoolHandler", LogID: 1}))
+
+	// the rejected callback is kept in the spool and retried after backoff
+	should.Eventually(func() bool { return atomic.LoadInt32(&attempts) >= 1 }, time.Second, time.Millisecond*10)
+	files, err := os.ReadDir(spoolDir)
+	should.NoError(err)
+	should.Len(files, 1)
+
+	select {
+	case logID := <-delivered:
+		should.Equal(int64(1), logID)
+	case <-time.After(time.Second * 3):
+		should.Fail("the rejected callback is not retried")
+	}
+	should.Eventually(func() bool {
+		files, _ := os.ReadDir(spoolDir)
+		return len(files) == 0
+	}, time.Second, time.Millisecond*10)
+}
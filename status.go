@@ -0,0 +1,353 @@
+package xxljob
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// JobRunning: the job is running.
+	JobRunning = "RUNNING"
+	// JobWaiting: the job is at the head of its queue but waits for a slot because of the concurrency limits.
+	JobWaiting = "WAITING"
+	// JobQueued: the job is queued behind the jobs of the same id.
+	JobQueued = "QUEUED"
+
+	redacted   = "***"
+	modulePath = "github.com/hyperjiang/xxljob"
+)
+
+// sensitiveKeys matches the names of the sensitive params.
+const sensitiveKeys = `(?:passw(?:or)?d|pwd|secret|token|api[_-]?key|access[_-]?key|private[_-]?key|credential|auth)`
+
+var (
+	// sensitiveKey matches the sensitive keys of JSON params.
+	sensitiveKey = regexp.MustCompile(`(?i)` + sensitiveKeys)
+
+	// sensitiveParam matches the values of the sensitive keys in the form of key=value pairs or flags,
+	// e.g. token=abc or --api-key=abc.
+	sensitiveParam = regexp.MustCompile(`(?i)("?[\w.-]*` + sensitiveKeys + `[\w.-]*"?\s*[:=]\s*)("(?:[^"\\]|\\.)*"|'[^']*'|[^\s,;&}]+)`)
+
+	// sensitiveFlag matches the values of the sensitive flags followed by their values, e.g. --password abc.
+	sensitiveFlag = regexp.MustCompile(`(?i)((?:^|\s)--?[\w.-]*` + sensitiveKeys + `[\w.-]*\s+)("(?:[^"\\]|\\.)*"|'[^']*'|(?:\\.|[^\s\\])+)`)
+)
+
+// RedactParams masks the values of the sensitive keys in the job params, such as password, secret and token.
+// JSON params are masked by key, and the whole value of a sensitive key is masked even if it is an object or array.
+// It is the default ParamsRedactor.
+func RedactParams(params string) string {
+	if redacted, ok := redactJSON(params); ok {
+		return redacted
+	}
+
+	params = redactMatches(sensitiveFlag, params)
+
+	return redactMatches(sensitiveParam, params)
+}
+
+// redactMatches masks the values captured by the second group of the pattern, the quotes are kept.
+func redactMatches(pattern *regexp.Regexp, params string) string {
+	return pattern.ReplaceAllStringFunc(params, func(s string) string {
+		m := pattern.FindStringSubmatch(s)
+		switch value := m[2]; value[0] {
+		case '"', '\'':
+			return m[1] + string(value[0]) + redacted + string(value[0])
+		default:
+			return m[1] + redacted
+		}
+	})
+}
+
+// jsonContainer is an object or array being rewritten by redactJSON.
+type jsonContainer struct {
+	object    bool
+	expectKey bool
+	n         int // number of elements written
+}
+
+// redactJSON masks the values of the sensitive keys in the JSON params, the order of the keys is kept.
+// It returns false if the params are not a JSON object or array.
+func redactJSON(params string) (string, bool) {
+	params = strings.TrimSpace(params)
+	if (!strings.HasPrefix(params, "{") && !strings.HasPrefix(params, "[")) || !json.Valid([]byte(params)) {
+		return "", false
+	}
+
+	dec := json.NewDecoder(strings.NewReader(params))
+	dec.UseNumber()
+
+	var (
+		b     strings.Builder
+		stack []*jsonContainer
+	)
+	// done marks an element of the current container as written.
+	done := func() {
+		if len(stack) > 0 {
+			top := stack[len(stack)-1]
+			top.n++
+			top.expectKey = top.object
+		}
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return b.String(), true
+		}
+		if err != nil {
+			return "", false
+		}
+
+		if delim, ok := tok.(json.Delim); ok && (delim == '}' || delim == ']') {
+			b.WriteRune(rune(delim))
+			stack = stack[:len(stack)-1]
+			done()
+			continue
+		}
+
+		if len(stack) > 0 {
+			top := stack[len(stack)-1]
+			switch {
+			case top.object && top.expectKey:
+				if top.n > 0 {
+					b.WriteByte(',')
+				}
+				key := tok.(string)
+				writeJSONValue(&b, key)
+				b.WriteByte(':')
+				top.expectKey = false
+				if sensitiveKey.MatchString(key) {
+					if err := skipJSONValue(dec); err != nil {
+						return "", false
+					}
+					writeJSONValue(&b, redacted)
+					done()
+				}
+				continue
+			case !top.object && top.n > 0:
+				b.WriteByte(',')
+			}
+		}
+
+		if delim, ok := tok.(json.Delim); ok {
+			b.WriteRune(rune(delim))
+			stack = append(stack, &jsonContainer{object: delim == '{', expectKey: delim == '{'})
+			continue
+		}
+
+		writeJSONValue(&b, tok)
+		done()
+	}
+}
+
+// skipJSONValue skips the next value, including all the tokens of an object or array.
+func skipJSONValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if delim, ok := tok.(json.Delim); ok {
+			if delim == '{' || delim == '[' {
+				depth++
+			} else {
+				depth--
+			}
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// writeJSONValue writes the scalar value in JSON without escaping HTML.
+func writeJSONValue(b *strings.Builder, v interface{}) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(v)
+	b.Write(bytes.TrimRight(buf.Bytes(), "\n"))
+}
+
+// JobStatus is the state of a running or queued job.
+type JobStatus struct {
+	JobID         int           `json:"jobId"`
+	LogID         int64         `json:"logId"`
+	Handler       string        `json:"handler"`
+	Params        string        `json:"params"` // redacted by ParamsRedactor
+	State         string        `json:"state"`  // JobRunning, JobWaiting or JobQueued
+	TriggerTime   time.Time     `json:"triggerTime"`
+	StartTime     *time.Time    `json:"startTime,omitempty"` // nil if the job is not started yet
+	Elapsed       time.Duration `json:"elapsed"`             // time since the job is started, 0 if it is not started yet
+	Deadline      *time.Time    `json:"deadline,omitempty"`  // when the job times out, nil if it has no timeout or is not started yet
+	QueuePosition int           `json:"queuePosition"`       // position in the queue of the job id, 0 means the head of the queue
+}
+
+// BuildInfo is the build information of the executor binary.
+type BuildInfo struct {
+	GoVersion     string `json:"goVersion"`
+	Path          string `json:"path,omitempty"` // main package path
+	Version       string `json:"version,omitempty"`
+	Revision      string `json:"revision,omitempty"` // vcs revision
+	Time          string `json:"time,omitempty"`     // vcs commit time
+	Modified      bool   `json:"modified,omitempty"` // whether the working tree has local changes
+	XXLJobVersion string `json:"xxljobVersion,omitempty"`
+}
+
+// ExecutorStatus is what the executor is doing right now.
+type ExecutorStatus struct {
+	AppName   string      `json:"appName"`
+	Address   string      `json:"address"` // address registered to xxl-job server
+	StartTime time.Time   `json:"startTime"`
+	Jobs      []JobStatus `json:"jobs"`
+	Handlers  []string    `json:"handlers"`
+	Build     BuildInfo   `json:"build"`
+}
+
+// RunningJobs returns the running and queued jobs, ordered by job id and then by queue position.
+func (e *Executor) RunningJobs() []JobStatus {
+	now := time.Now()
+
+	e.mu.Lock()
+	ids := make([]int, 0, len(e.queues))
+	for id := range e.queues {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var jobs []JobStatus
+	for _, id := range ids {
+		q := e.queues[id]
+		if job := q.running; job != nil {
+			jobs = append(jobs, e.jobStatus(job, now, 0))
+		}
+		for i, job := range q.pending {
+			jobs = append(jobs, e.jobStatus(job, now, i+1))
+		}
+	}
+	e.mu.Unlock()
+
+	return jobs
+}
+
+// jobStatus returns the state of the job at the given position of its queue.
+// The caller must hold e.mu.
+func (e *Executor) jobStatus(job *Job, now time.Time, position int) JobStatus {
+	status := JobStatus{
+		JobID:         job.ID,
+		LogID:         job.LogID,
+		Handler:       job.Name,
+		Params:        e.redactParams(job.Param.Params),
+		State:         JobQueued,
+		TriggerTime:   job.Param.TriggerTime,
+		QueuePosition: position,
+	}
+
+	if position > 0 {
+		return status
+	}
+
+	if !job.slotted {
+		status.State = JobWaiting
+		return status
+	}
+
+	start := job.startedAt
+	status.State = JobRunning
+	status.StartTime = &start
+	status.Elapsed = TruncateDuration(now.Sub(start))
+	if job.Timeout > 0 {
+		deadline := start.Add(time.Duration(job.Timeout) * time.Second)
+		status.Deadline = &deadline
+	}
+
+	return status
+}
+
+// redactParams redacts the job params with ParamsRedactor, or RedactParams if it is not set.
+func (e *Executor) redactParams(params string) string {
+	if e.ParamsRedactor != nil {
+		return e.ParamsRedactor(params)
+	}
+
+	return RedactParams(params)
+}
+
+// HandlerNames returns the names of the registered job handlers in alphabetical order.
+func (e *Executor) HandlerNames() []string {
+	var names []string
+	e.handlers.Range(func(key, _ interface{}) bool {
+		names = append(names, key.(string))
+		return true
+	})
+	sort.Strings(names)
+
+	return names
+}
+
+// Status returns the running and queued jobs, the registered job handlers and the build information.
+func (e *Executor) Status() ExecutorStatus {
+	return ExecutorStatus{
+		AppName:   e.AppName,
+		Address:   e.registry.RegistryValue,
+		StartTime: e.createdAt,
+		Jobs:      e.RunningJobs(),
+		Handlers:  e.HandlerNames(),
+		Build:     readBuildInfo(),
+	}
+}
+
+// readBuildInfo reads the build information embedded in the binary.
+func readBuildInfo() BuildInfo {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return BuildInfo{}
+	}
+
+	info := BuildInfo{
+		GoVersion: bi.GoVersion,
+		Path:      bi.Path,
+		Version:   bi.Main.Version,
+	}
+
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			info.Time = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+
+	if bi.Main.Path == modulePath {
+		info.XXLJobVersion = bi.Main.Version
+	}
+	for _, dep := range bi.Deps {
+		if dep.Path == modulePath {
+			info.XXLJobVersion = dep.Version
+		}
+	}
+
+	return info
+}
+
+// status is for checking what the executor is doing right now.
+func (e *Executor) status(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+
+	res := NewSuccResponse()
+	res.Content = e.Status()
+
+	fmt.Fprintln(w, res.String())
+}
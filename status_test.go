@@ -0,0 +1,120 @@
+package xxljob_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	resty "github.com/go-resty/resty/v2"
+	"github.com/hyperjiang/xxljob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactParams(t *testing.T) {
+	should := require.New(t)
+
+	should.Equal(`{"user":"bob","password":"***"}`, xxljob.RedactParams(`{"user": "bob", "password": "p@ss \"word\""}`))
+	should.Equal(`{"credentials":"***","limit":10}`, xxljob.RedactParams(`{"credentials": {"user": "a", "pass": "b"}, "limit": 10}`))
+	should.Equal(`{"tokens":"***"}`, xxljob.RedactParams(`{"tokens": ["a","b"]}`))
+	should.Equal(`[{"db":{"Secret":"***","host":"<h>"}},1.50]`, xxljob.RedactParams(`[{"db": {"Secret": 1, "host": "<h>"}}, 1.50]`))
+	should.Equal(`--password "***" --limit 10`, xxljob.RedactParams(`--password "a b c" --limit 10`))
+	should.Equal(`date=x --api-key *** -auth-token '***'`, xxljob.RedactParams(`date=x --api-key abc -auth-token 'x y'`))
+	should.Equal(`user=bob&api_key=***`, xxljob.RedactParams(`user=bob&api_key=abc`))
+	should.Equal(`--db-secret='***' --limit=10`, xxljob.RedactParams(`--db-secret='s e c' --limit=10`))
+	should.Equal(`TOKEN=***, date=2021-01-01`, xxljob.RedactParams(`TOKEN=abc, date=2021-01-01`))
+	should.Equal("hello world", xxljob.RedactParams("hello world"))
+}
+
+func TestRunningJobs(t *testing.T) {
+	should := require.New(t)
+
+	admin, _ := newFakeAdmin()
+	defer admin.Close()
+
+	e := xxljob.NewExecutor(
+		xxljob.WithAppName(appName),
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(t.TempDir()),
+		xxljob.WithCallbackInterval("10ms"),
+	)
+	defer e.Stop()
+
+	release := make(chan struct{})
+	block := func(ctx context.Context, param xxljob.JobParam) error {
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	e.AddJobHandler("block", block, xxljob.WithMaxConcurrency(1))
+	e.AddJobHandler("idle", block)
+
+	should.Empty(e.RunningJobs())
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	should.NoError(e.TriggerJob(xxljob.RunParam{JobID: 1, ExecutorHandler: "block", ExecutorParams: "token=abc", ExecutorTimeout: 60, LogID: 1, LogDateTime: now}))
+	should.NoError(e.TriggerJob(xxljob.RunParam{JobID: 1, ExecutorHandler: "block", LogID: 2, LogDateTime: now}))
+	should.NoError(e.TriggerJob(xxljob.RunParam{JobID: 2, ExecutorHandler: "block", LogID: 3, LogDateTime: now}))
+
+	jobs := e.RunningJobs()
+	should.Len(jobs, 3)
+
+	running := jobs[0]
+	should.Equal(1, running.JobID)
+	should.Equal(int64(1), running.LogID)
+	should.Equal("block", running.Handler)
+	should.Equal("token=***", running.Params)
+	should.Equal(xxljob.JobRunning, running.State)
+	should.Equal(0, running.QueuePosition)
+	should.Equal(now, running.TriggerTime.UnixNano()/int64(time.Millisecond))
+	should.NotNil(running.StartTime)
+	should.NotNil(running.Deadline)
+	should.Equal(time.Minute, running.Deadline.Sub(*running.StartTime))
+
+	queued := jobs[1]
+	should.Equal(int64(2), queued.LogID)
+	should.Equal(xxljob.JobQueued, queued.State)
+	should.Equal(1, queued.QueuePosition)
+	should.Nil(queued.StartTime)
+	should.Zero(queued.Elapsed)
+
+	// The job of another id waits for the slot of the handler.
+	waiting := jobs[2]
+	should.Equal(2, waiting.JobID)
+	should.Equal(xxljob.JobWaiting, waiting.State)
+	should.Equal(0, waiting.QueuePosition)
+	should.Nil(waiting.StartTime)
+
+	srv := httptest.NewServer(e.Handler())
+	defer srv.Close()
+
+	resp, err := resty.New().R().SetHeader("XXL-JOB-ACCESS-TOKEN", accessToken).Get(srv.URL + "/status")
+	should.NoError(err)
+	var res struct {
+		Code    int                   `json:"code"`
+		Content xxljob.ExecutorStatus `json:"content"`
+	}
+	should.NoError(json.Unmarshal(resp.Body(), &res))
+	should.Equal(200, res.Code)
+	should.Equal(appName, res.Content.AppName)
+	should.True(strings.HasPrefix(res.Content.Address, "http://"))
+	should.Equal([]string{"block", "idle"}, res.Content.Handlers)
+	should.Len(res.Content.Jobs, 3)
+	should.Equal("token=***", res.Content.Jobs[0].Params)
+	should.NotEmpty(res.Content.Build.GoVersion)
+
+	resp, err = resty.New().R().SetHeader("XXL-JOB-ACCESS-TOKEN", "wrong").Get(srv.URL + "/status")
+	should.NoError(err)
+	should.Contains(resp.String(), "the access token is wrong")
+
+	close(release)
+	should.Eventually(func() bool {
+		return len(e.RunningJobs()) == 0
+	}, time.Second, time.Millisecond*10)
+}
@@ -0,0 +1,176 @@
+package xxljob
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SpanKind is the kind of a span.
+type SpanKind int
+
+const (
+	// SpanKindInternal: the span of an operation inside the executor, e.g. a job execution.
+	SpanKindInternal SpanKind = iota
+	// SpanKindClient: the span of a request to xxl-job server.
+	SpanKindClient
+)
+
+// Attribute is a key value pair describing a span.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attr creates an attribute.
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Tracer starts spans around the job executions and the requests to xxl-job server.
+// It keeps the executor independent of any tracing library, e.g. it can be implemented on top of OpenTelemetry.
+type Tracer interface {
+	// Start starts a span, the returned context carries the span and is passed into the job handler.
+	Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is an operation traced by a Tracer.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// noopTracer is used if no tracer is configured.
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attrs ...Attribute) {}
+func (noopSpan) RecordError(err error)            {}
+func (noopSpan) End()                             {}
+
+// tracer returns the configured tracer or a no-op one.
+func (e *Executor) tracer() Tracer {
+	if e.Tracer == nil {
+		return noopTracer{}
+	}
+
+	return e.Tracer
+}
+
+// RecordedSpan is a span recorded by InMemoryTracer.
+type RecordedSpan struct {
+	ID         uint64
+	ParentID   uint64 // 0 if the span has no parent
+	Name       string
+	Kind       SpanKind
+	Attributes map[string]interface{}
+	Err        error
+	StartTime  time.Time
+	EndTime    time.Time
+}
+
+// InMemoryTracer records the spans in memory, it is useful in tests.
+type InMemoryTracer struct {
+	mu     sync.Mutex
+	nextID uint64
+	spans  []RecordedSpan
+}
+
+// NewInMemoryTracer creates an in-memory tracer.
+func NewInMemoryTracer() *InMemoryTracer {
+	return &InMemoryTracer{}
+}
+
+type inMemorySpanKey struct{}
+
+// Start starts a span, whose parent is the in-memory span in ctx if any.
+func (t *InMemoryTracer) Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, Span) {
+	t.mu.Lock()
+	t.nextID++
+	id := t.nextID
+	t.mu.Unlock()
+
+	span := &inMemorySpan{
+		tracer: t,
+		span: RecordedSpan{
+			ID:         id,
+			Name:       name,
+			Kind:       kind,
+			Attributes: make(map[string]interface{}),
+			StartTime:  time.Now(),
+		},
+	}
+	if parent, ok := ctx.Value(inMemorySpanKey{}).(*inMemorySpan); ok {
+		span.span.ParentID = parent.span.ID
+	}
+	span.SetAttributes(attrs...)
+
+	return context.WithValue(ctx, inMemorySpanKey{}, span), span
+}
+
+// Spans returns the ended spans in the order of ending.
+func (t *InMemoryTracer) Spans() []RecordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]RecordedSpan(nil), t.spans...)
+}
+
+// Reset removes the recorded spans.
+func (t *InMemoryTracer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.spans = nil
+}
+
+type inMemorySpan struct {
+	tracer *InMemoryTracer
+	mu     sync.Mutex
+	span   RecordedSpan
+	ended  bool
+}
+
+func (s *inMemorySpan) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, attr := range attrs {
+		s.span.Attributes[attr.Key] = attr.Value
+	}
+}
+
+func (s *inMemorySpan) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.span.Err = err
+}
+
+// End records the span, only the first call takes effect.
+func (s *inMemorySpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.span.EndTime = time.Now()
+
+	span := s.span
+	span.Attributes = make(map[string]interface{}, len(s.span.Attributes))
+	for k, v := range s.span.Attributes {
+		span.Attributes[k] = v
+	}
+	s.mu.Unlock()
+
+	s.tracer.mu.Lock()
+	s.tracer.spans = append(s.tracer.spans, span)
+	s.tracer.mu.Unlock()
+}
@@ -0,0 +1,95 @@
+package xxljob_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hyperjiang/xxljob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracing(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	tracer := xxljob.NewInMemoryTracer()
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(t.TempDir()),
+		xxljob.WithCallbackInterval("10ms"),
+		xxljob.WithTracer(tracer),
+	)
+	defer e.Stop()
+
+	e.AddJobHandler("demo", func(ctx context.Context, param xxljob.JobParam) error {
+		// The span of the job is passed into the handler.
+		_, span := tracer.Start(ctx, "child", xxljob.SpanKindInternal)
+		span.End()
+
+		if param.Params == "fail" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	run := func(logID int64, params string) {
+		should.NoError(e.TriggerJob(xxljob.RunParam{
+			JobID:                 1,
+			ExecutorHandler:       "demo",
+			ExecutorParams:        params,
+			ExecutorBlockStrategy: xxljob.SerialExecution,
+			LogID:                 logID,
+			LogDateTime:           time.Now().UnixNano() / int64(time.Millisecond),
+			BroadcastIndex:        1,
+			BroadcastTotal:        3,
+		}))
+		<-callbacks
+	}
+	run(1, "ok")
+	run(2, "fail")
+
+	var jobs, children, admins []xxljob.RecordedSpan
+	should.Eventually(func() bool {
+		jobs, children, admins = nil, nil, nil
+		for _, span := range tracer.Spans() {
+			switch span.Name {
+			case "xxljob.job demo":
+				jobs = append(jobs, span)
+			case "child":
+				children = append(children, span)
+			case "xxljob.admin /api/callback":
+				admins = append(admins, span)
+			}
+		}
+		return len(jobs) == 2 && len(admins) >= 2
+	}, time.Second, time.Millisecond*10)
+
+	should.Len(children, 2)
+	should.Equal(jobs[0].ID, children[0].ParentID)
+
+	attrs := jobs[0].Attributes
+	should.Equal(xxljob.SpanKindInternal, jobs[0].Kind)
+	should.Equal("demo", attrs["xxljob.handler"])
+	should.Equal(1, attrs["xxljob.job_id"])
+	should.Equal(int64(1), attrs["xxljob.log_id"])
+	should.Equal(1, attrs["xxljob.sharding_index"])
+	should.Equal(3, attrs["xxljob.sharding_total"])
+	should.Equal(xxljob.SerialExecution, attrs["xxljob.block_strategy"])
+	should.Equal("success", attrs["xxljob.outcome"])
+	should.NoError(jobs[0].Err)
+
+	should.Equal("failure", jobs[1].Attributes["xxljob.outcome"])
+	should.EqualError(jobs[1].Err, "failed")
+
+	should.Equal(xxljob.SpanKindClient, admins[0].Kind)
+	should.Equal(200, admins[0].Attributes["http.status_code"])
+	should.Equal(admin.URL+"/api/callback", admins[0].Attributes["http.url"])
+
+	tracer.Reset()
+	should.Empty(tracer.Spans())
+}
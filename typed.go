@@ -0,0 +1,372 @@
+package xxljob
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Validator is implemented by the typed params which validate themselves after decoding.
+type Validator interface {
+	Validate() error
+}
+
+// TypedHandler converts a handler with typed params into a JobHandler, see DecodeParams for how the params are decoded.
+// If the params are invalid, the job fails with the message "invalid params: ..." without calling the handler.
+func TypedHandler[T any](h func(ctx context.Context, param JobParam, args T) error) JobHandler {
+	return func(ctx context.Context, param JobParam) error {
+		var args T
+		if err := DecodeParams(param.Params, &args); err != nil {
+			return fmt.Errorf("invalid params: %w", err)
+		}
+
+		return h(ctx, param, args)
+	}
+}
+
+// AddTypedHandler registers a job handler with typed params by name, e.g.
+//
+//	type SyncArgs struct {
+//		Date   string `param:"date,required"`
+//		Limit  int    `param:"limit" default:"100"`
+//		DryRun bool   `param:"dry-run"`
+//	}
+//
+//	xxljob.AddTypedHandler(e, "sync", func(ctx context.Context, param xxljob.JobParam, args SyncArgs) error {
+//		...
+//	})
+func AddTypedHandler[T any](e *Executor, name string, h func(ctx context.Context, param JobParam, args T) error, opts ...HandlerOption) {
+	e.AddJobHandler(name, TypedHandler(h), opts...)
+}
+
+// DecodeParams decodes the executor params into v, which must be a pointer. If it points to a nil pointer,
+// the element is allocated.
+//
+// The params can be a JSON value, or key=value pairs and CLI-style flags separated by spaces,
+// e.g. `date=2024-01-01 limit=10` or `--date 2024-01-01 --limit=10 --dry-run`, values can be quoted.
+// The latter is only supported by structs, whose fields are matched by the name in the `param` tag,
+// the `json` tag or the field name, ignoring case, '-' and '_'. The fields of the embedded structs are promoted
+// like encoding/json, but the embedded struct pointers are not supported.
+// The params of a string are taken as raw text unless they are a JSON string.
+//
+// The `default` tag sets the value of a field before decoding, and the fields with the `required` option
+// in the `param` tag, e.g. `param:"date,required"`, must not be zero after decoding.
+// At last, v is validated by its Validate method if it implements Validator.
+func DecodeParams(params string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("decode params into a non-pointer value")
+	}
+
+	// If v points to a nil pointer, e.g. the params of a TypedHandler of a pointer type, the element is allocated,
+	// so that the defaults and the required fields are applied even if the params are empty.
+	elem := rv.Elem()
+	for elem.Kind() == reflect.Ptr {
+		if elem.IsNil() {
+			elem.Set(reflect.New(elem.Type().Elem()))
+		}
+		elem = elem.Elem()
+	}
+	v = elem.Addr().Interface()
+
+	var fields map[string]paramField
+	if elem.Kind() == reflect.Struct {
+		fields = paramFields(elem.Type())
+		for _, f := range fields {
+			if f.def != "" {
+				if err := setParamValue(elem.FieldByIndex(f.index), f.def); err != nil {
+					return fmt.Errorf("default value of %s: %w", f.name, err)
+				}
+			}
+		}
+	}
+
+	params = strings.TrimSpace(params)
+	switch {
+	case params == "":
+	case fields == nil:
+		// The params of the other types are JSON values, e.g. 5, true or "x", and a string also accepts raw text.
+		if err := json.Unmarshal([]byte(params), v); err != nil {
+			if elem.Kind() != reflect.String {
+				return fmt.Errorf("params of %s must be JSON", elem.Type())
+			}
+			elem.SetString(params)
+		}
+	case strings.HasPrefix(params, "{") || strings.HasPrefix(params, "["):
+		if err := json.Unmarshal([]byte(params), v); err != nil {
+			return err
+		}
+	default:
+		if err := decodeArgs(params, elem, fields); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range fields {
+		if f.required && elem.FieldByIndex(f.index).IsZero() {
+			return fmt.Errorf("%s is required", f.name)
+		}
+	}
+
+	if validator, ok := v.(Validator); ok {
+		return validator.Validate()
+	}
+
+	return nil
+}
+
+// paramField is a struct field which can be set by the params.
+type paramField struct {
+	index    []int // index sequence for reflect.Value.FieldByIndex
+	name     string
+	def      string
+	required bool
+}
+
+// paramFields returns the settable fields of the struct, keyed by the normalized names.
+// The fields of the embedded structs are promoted, unless they are shadowed by the outer fields.
+func paramFields(t reflect.Type) map[string]paramField {
+	fields := make(map[string]paramField)
+	var embedded []reflect.StructField
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, hasTag := sf.Tag.Lookup("param")
+		parts := strings.Split(tag, ",")
+		if parts[0] == "-" {
+			continue
+		}
+
+		// The embedded struct without a name in the tags is flattened, even if its type is unexported.
+		jsonName := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct && parts[0] == "" && jsonName == "" {
+			embedded = append(embedded, sf)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue // unexported
+		}
+
+		f := paramField{index: sf.Index, name: sf.Name, def: sf.Tag.Get("default")}
+		var names []string
+		if hasTag {
+			if parts[0] != "" {
+				f.name = parts[0]
+				names = append(names, parts[0])
+			}
+			for _, opt := range parts[1:] {
+				if opt == "required" {
+					f.required = true
+				}
+			}
+		}
+		if jsonName != "" && jsonName != "-" {
+			names = append(names, jsonName)
+		}
+		names = append(names, sf.Name)
+
+		for _, name := range names {
+			if _, ok := fields[normalizeParamName(name)]; !ok {
+				fields[normalizeParamName(name)] = f
+			}
+		}
+	}
+
+	for _, sf := range embedded {
+		for name, f := range paramFields(sf.Type) {
+			if _, ok := fields[name]; !ok {
+				f.index = append(append([]int{}, sf.Index...), f.index...)
+				fields[name] = f
+			}
+		}
+	}
+
+	return fields
+}
+
+// normalizeParamName makes the name case insensitive and ignores '-' and '_'.
+func normalizeParamName(name string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(name))
+}
+
+// decodeArgs decodes key=value pairs and CLI-style flags into the struct.
+func decodeArgs(params string, v reflect.Value, fields map[string]paramField) error {
+	args, err := splitArgs(params)
+	if err != nil {
+		return err
+	}
+
+	set := func(key, value string) error {
+		f, ok := fields[normalizeParamName(key)]
+		if !ok {
+			return fmt.Errorf("unknown param %q", key)
+		}
+		if err := setParamValue(v.FieldByIndex(f.index), value); err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+		return nil
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if !strings.HasPrefix(arg, "-") {
+			key, value, ok := strings.Cut(arg, "=")
+			if !ok {
+				return fmt.Errorf("unexpected argument %q", arg)
+			}
+			if err := set(key, value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// --key=value, --key value or --flag
+		key := strings.TrimLeft(arg, "-")
+		if k, value, ok := strings.Cut(key, "="); ok {
+			if err := set(k, value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		f, ok := fields[normalizeParamName(key)]
+		if ok && v.FieldByIndex(f.index).Kind() == reflect.Bool {
+			if err := set(key, "true"); err != nil {
+				return err
+			}
+			continue
+		}
+		if i+1 >= len(args) {
+			return fmt.Errorf("flag %q needs a value", arg)
+		}
+		i++
+		if err := set(key, args[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitArgs splits the params by spaces, the quoted values and the escaped characters are kept as they are.
+func splitArgs(s string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		quote   rune
+		escaped bool
+		inArg   bool
+	)
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setParamValue converts the string into the type of the value and sets it.
+func setParamValue(v reflect.Value, s string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == durationType {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		// Comma separated values.
+		parts := strings.Split(s, ",")
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setParamValue(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.Ptr:
+		ptr := reflect.New(v.Type().Elem())
+		if err := setParamValue(ptr.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(ptr)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package xxljob_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hyperjiang/xxljob"
+	"github.com/stretchr/testify/require"
+)
+
+type syncArgs struct {
+	Date    string        `param:"date,required" json:"date"`
+	Limit   int           `param:"limit" json:"limit" default:"100"`
+	DryRun  bool          `param:"dry-run" json:"dry_run"`
+	Tables  []string      `json:"tables"`
+	Timeout time.Duration `default:"1m"`
+	Ratio   *float64
+	secret  string
+}
+
+func (a syncArgs) Validate() error {
+	if a.Limit <= 0 {
+		return errors.New("limit must be positive")
+	}
+	return nil
+}
+
+func TestDecodeParams(t *testing.T) {
+	should := require.New(t)
+
+	var args syncArgs
+	should.NoError(xxljob.DecodeParams(`{"date":"2024-01-01","dry_run":true,"tables":["a","b"]}`, &args))
+	should.Equal("2024-01-01", args.Date)
+	should.Equal(100, args.Limit)
+	should.True(args.DryRun)
+	should.Equal([]string{"a", "b"}, args.Tables)
+	should.Equal(time.Minute, args.Timeout)
+
+	args = syncArgs{}
+	should.NoError(xxljob.DecodeParams(`date=2024-01-01 limit=5 tables=a,b timeout=5s ratio=0.5`, &args))
+	should.Equal("2024-01-01", args.Date)
+	should.Equal(5, args.Limit)
+	should.False(args.DryRun)
+	should.Equal([]string{"a", "b"}, args.Tables)
+	should.Equal(time.Second*5, args.Timeout)
+	should.Equal(0.5, *args.Ratio)
+
+	args = syncArgs{}
+	should.NoError(xxljob.DecodeParams(`--date "2024-01-01" --dry-run -limit=7 --DRY_RUN=false --tables 'a b'`, &args))
+	should.Equal("2024-01-01", args.Date)
+	should.Equal(7, args.Limit)
+	should.False(args.DryRun)
+	should.Equal([]string{"a b"}, args.Tables)
+
+	for params, msg := range map[string]string{
+		``:                            "date is required",
+		`limit=1`:                     "date is required",
+		`date=x limit=0`:              "limit must be positive",
+		`date=x limit=abc`:            `limit: strconv.ParseInt: parsing "abc": invalid syntax`,
+		`date=x unknown=1`:            `unknown param "unknown"`,
+		`date=x secret=1`:             `unknown param "secret"`,
+		`date=x oops`:                 `unexpected argument "oops"`,
+		`--date`:                      `flag "--date" needs a value`,
+		`date="x`:                     "unterminated quote or escape",
+		`{"date":"x","limit":"many"}`: "json: cannot unmarshal string into Go struct field syncArgs.limit of type int",
+	} {
+		args = syncArgs{}
+		should.EqualError(xxljob.DecodeParams(params, &args), msg, params)
+	}
+
+	var m map[string]int
+	should.NoError(xxljob.DecodeParams(`{"a":1}`, &m))
+	should.Equal(map[string]int{"a": 1}, m)
+	should.EqualError(xxljob.DecodeParams(`a=1`, &m), "params of map[string]int must be JSON")
+
+	// The params of a scalar are JSON values, and a string also accepts raw text.
+	var n int
+	should.NoError(xxljob.DecodeParams(` 5 `, &n))
+	should.Equal(5, n)
+	should.EqualError(xxljob.DecodeParams(`five`, &n), "params of int must be JSON")
+	var b bool
+	should.NoError(xxljob.DecodeParams(`true`, &b))
+	should.True(b)
+	var str string
+	should.NoError(xxljob.DecodeParams(`"x y"`, &str))
+	should.Equal("x y", str)
+	should.NoError(xxljob.DecodeParams(`2024-01-01 [full]`, &str))
+	should.Equal("2024-01-01 [full]", str)
+	var ids []int
+	should.NoError(xxljob.DecodeParams(`[1,2]`, &ids))
+	should.Equal([]int{1, 2}, ids)
+
+	should.Error(xxljob.DecodeParams(`{}`, args))
+
+	// The element of a nil pointer is allocated, so that the defaults and the required fields are applied.
+	var ptr *syncArgs
+	should.EqualError(xxljob.DecodeParams(``, &ptr), "date is required")
+	should.NotNil(ptr)
+	should.Equal(100, ptr.Limit)
+	ptr = nil
+	should.NoError(xxljob.DecodeParams(`date=2024-01-01`, &ptr))
+	should.Equal("2024-01-01", ptr.Date)
+	should.Equal(time.Minute, ptr.Timeout)
+}
+
+type baseArgs struct {
+	Date  string `param:"date,required"`
+	Limit int    `default:"10"`
+}
+
+type embeddedArgs struct {
+	baseArgs
+	Limit  string
+	Tables []string
+}
+
+func TestDecodeParamsEmbedded(t *testing.T) {
+	should := require.New(t)
+
+	var args embeddedArgs
+	should.NoError(xxljob.DecodeParams(`date=2024-01-01 limit=all tables=a,b`, &args))
+	should.Equal("2024-01-01", args.Date)
+	should.Equal("all", args.Limit)
+	should.Zero(args.baseArgs.Limit) // shadowed by the outer field
+	should.Equal([]string{"a", "b"}, args.Tables)
+
+	args = embeddedArgs{}
+	should.NoError(xxljob.DecodeParams(`{"Date":"2024-01-02"}`, &args))
+	should.Equal("2024-01-02", args.Date)
+
+	should.EqualError(xxljob.DecodeParams(`tables=a`, &embeddedArgs{}), "date is required")
+}
+
+func TestTypedHandlerScalar(t *testing.T) {
+	should := require.New(t)
+
+	got := make(chan int, 1)
+	h := xxljob.TypedHandler(func(ctx context.Context, param xxljob.JobParam, n int) error {
+		got <- n
+		return nil
+	})
+
+	should.NoError(h(context.Background(), xxljob.JobParam{Params: "42"}))
+	should.Equal(42, <-got)
+	should.EqualError(h(context.Background(), xxljob.JobParam{Params: "x"}), "invalid params: params of int must be JSON")
+}
+
+func TestTypedHandler(t *testing.T) {
+	should := require.New(t)
+
+	admin, callbacks := newFakeAdmin()
+	defer admin.Close()
+
+	e := xxljob.NewExecutor(
+		xxljob.WithHost(admin.URL),
+		xxljob.WithLogger(xxljob.DummyLogger()),
+		xxljob.WithLogDir(t.TempDir()),
+		xxljob.WithCallbackInterval("10ms"),
+	)
+	defer e.Stop()
+
+	got := make(chan syncArgs, 1)
+	xxljob.AddTypedHandler(e, "sync", func(ctx context.Context, param xxljob.JobParam, args syncArgs) error {
+		got <- args
+		return nil
+	}, xxljob.WithDescription("sync tables"))
+
+	opts, ok := e.GetHandlerOptions("sync")
+	should.True(ok)
+	should.Equal("sync tables", opts.Description)
+
+	run := func(logID int64, params string) xxljob.CallbackParam {
+		should.NoError(e.TriggerJob(xxljob.RunParam{
+			JobID:           1,
+			ExecutorHandler: "sync",
+			ExecutorParams:  params,
+			LogID:           logID,
+			LogDateTime:     time.Now().UnixNano() / int64(time.Millisecond),
+		}))
+		return <-callbacks
+	}
+
+	cb := run(1, "--date 2024-01-01 --limit 10")
+	should.Equal(200, cb.HandleCode)
+	args := <-got
+	should.Equal("2024-01-01", args.Date)
+	should.Equal(10, args.Limit)
+
+	cb = run(2, "limit=10")
+	should.Equal(500, cb.HandleCode)
+	should.Equal("invalid params: date is required", cb.HandleMsg)
+	should.Empty(got)
+}
@@ -3,6 +3,9 @@ package xxljob
 import (
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
+	"runtime"
 	"time"
 )
 
@@ -51,3 +54,50 @@ func TruncateDuration(d time.Duration) time.Duration {
 
 	return d.Truncate(time.Microsecond)
 }
+
+// writeFileAtomic writes the data to a temporary file in the same directory then renames it to the file,
+// so that a reader or a crash never sees a partial file. The file and the directory are synced to disk,
+// so that the renamed file survives a power loss.
+func writeFileAtomic(file string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp, file)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	return syncDir(filepath.Dir(file))
+}
+
+// syncDir syncs the directory so that the renamed entries in it are persisted.
+// It is not supported on windows, where the error is ignored.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil && runtime.GOOS != "windows" {
+		return err
+	}
+
+	return nil
+}